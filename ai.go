@@ -17,6 +17,7 @@ package main
 
 import (
 	"math/rand"
+	"sort"
 )
 
 // The AI interface provides the interface for different AIs.
@@ -33,59 +34,129 @@ type AI interface {
 
 // GetAI returns a singe AI out of the current rotation.
 func GetAI() AI {
-	var AIArray = []func() AI{
-		func() AI { return new(EndRound) },
-		func() AI { return new(HeartAI) },
-		func() AI { return new(ChristmasAI) },
-		func() AI { return new(StupidAI) },
-		func() AI { return new(StupidAI) },
-		func() AI { return new(StupidAI) },
-		func() AI { return new(StupidAI) },
-		func() AI { return new(StupidAI) },
-		func() AI { return new(SnailAI) },
-		func() AI { return new(SnailAI) },
-		func() AI { return new(SuperSnailAI) },
-		func() AI { return new(SuperSnailAI) },
-		func() AI { return new(SuperSnailAI) },
-		func() AI { return new(JumpingSnailAI) },
-		func() AI { return new(JumpingSnailAI) },
-		func() AI { return new(JumpingSnailAI) },
-		func() AI { return new(JumpingSnailAI) },
-		func() AI { return new(JumpingSnailAI) },
-		func() AI { return new(LargestFreeAI) },
-		func() AI { return new(LargestFreeAI) },
-		func() AI { return new(LargestFreeAI) },
-		func() AI { return new(LargestFreeAI) },
-		func() AI { return new(LargestFreeAI) },
-		func() AI { return new(JumpingLargestFreeAI) },
-		func() AI { return new(JumpingLargestFreeAI) },
-		func() AI { return new(JumpingLargestFreeAI) },
-		func() AI { return new(JumpingLargestFreeAI) },
-		func() AI { return new(JumpingLargestFreeAI) },
-		func() AI { return new(RandomAI) },
-		func() AI { return new(RandomAI) },
-		func() AI { return new(BadRandomAI) },
-		func() AI { return new(RandomAISlow) },
-		func() AI { return new(RandomAISlow) },
-		func() AI { return new(SuperRandomAI) },
-		func() AI { return new(SuperRandomAI) },
-		func() AI { return new(SuperRandomAI) },
-		func() AI { return new(SuperRandomAI) },
-		func() AI { return new(SuperRandomAI) },
-		func() AI { return new(MirrorAI) },
-		func() AI { return new(MirrorAI) },
-		func() AI { return new(MirrorAI) },
-		func() AI { return new(MirrorAI) },
-		func() AI { return new(JumpAI) },
-		func() AI { return new(JumpAI) },
-		func() AI { return new(JumpAI) },
-		func() AI { return new(JumpAI) },
-		func() AI { return new(JumpAI) },
-		func() AI { return new(MetaAI) },
-		func() AI { return new(MetaAI) },
-		func() AI { return new(MetaAI) },
-		func() AI { return new(MetaAI) },
-		func() AI { return new(MetaAI) },
+	return aiRotation[rand.Intn(len(aiRotation))]()
+}
+
+// aiRotation holds the constructors of the AIs selected by GetAI. AIs are listed multiple times to increase their probability.
+var aiRotation = []func() AI{
+	func() AI { return new(EndRound) },
+	func() AI { return new(HeartAI) },
+	func() AI { return new(ChristmasAI) },
+	func() AI { return new(StupidAI) },
+	func() AI { return new(StupidAI) },
+	func() AI { return new(StupidAI) },
+	func() AI { return new(StupidAI) },
+	func() AI { return new(StupidAI) },
+	func() AI { return new(SnailAI) },
+	func() AI { return new(SnailAI) },
+	func() AI { return new(SuperSnailAI) },
+	func() AI { return new(SuperSnailAI) },
+	func() AI { return new(SuperSnailAI) },
+	func() AI { return new(JumpingSnailAI) },
+	func() AI { return new(JumpingSnailAI) },
+	func() AI { return new(JumpingSnailAI) },
+	func() AI { return new(JumpingSnailAI) },
+	func() AI { return new(JumpingSnailAI) },
+	func() AI { return new(LargestFreeAI) },
+	func() AI { return new(LargestFreeAI) },
+	func() AI { return new(LargestFreeAI) },
+	func() AI { return new(LargestFreeAI) },
+	func() AI { return new(LargestFreeAI) },
+	func() AI { return new(JumpingLargestFreeAI) },
+	func() AI { return new(JumpingLargestFreeAI) },
+	func() AI { return new(JumpingLargestFreeAI) },
+	func() AI { return new(JumpingLargestFreeAI) },
+	func() AI { return new(JumpingLargestFreeAI) },
+	func() AI { return new(RandomAI) },
+	func() AI { return new(RandomAI) },
+	func() AI { return new(BadRandomAI) },
+	func() AI { return new(RandomAISlow) },
+	func() AI { return new(RandomAISlow) },
+	func() AI { return new(SuperRandomAI) },
+	func() AI { return new(SuperRandomAI) },
+	func() AI { return new(SuperRandomAI) },
+	func() AI { return new(SuperRandomAI) },
+	func() AI { return new(SuperRandomAI) },
+	func() AI { return new(MirrorAI) },
+	func() AI { return new(MirrorAI) },
+	func() AI { return new(MirrorAI) },
+	func() AI { return new(MirrorAI) },
+	func() AI { return new(JumpAI) },
+	func() AI { return new(JumpAI) },
+	func() AI { return new(JumpAI) },
+	func() AI { return new(JumpAI) },
+	func() AI { return new(JumpAI) },
+	func() AI { return new(MetaAI) },
+	func() AI { return new(MetaAI) },
+	func() AI { return new(MetaAI) },
+	func() AI { return new(MetaAI) },
+	func() AI { return new(MetaAI) },
+}
+
+// answeringAI wraps an AI so that GetState always sends an answer, which SimulateGame waits for.
+// If the wrapped AI does not answer, nothing is sent to the server - like a timeout.
+type answeringAI struct {
+	AI
+	c chan string
+}
+
+// GetChannel receives the answer channel.
+func (a *answeringAI) GetChannel(c chan string) {
+	a.c = c
+}
+
+// GetState passes the game state to the wrapped AI and forwards its answer.
+func (a *answeringAI) GetState(g *Game) {
+	inner := make(chan string, 1)
+	a.AI.GetChannel(inner)
+	a.AI.GetState(g)
+	answer := ""
+	select {
+	case answer = <-inner:
+	default:
+	}
+	select {
+	case a.c <- answer:
+	default:
+	}
+}
+
+// aiConstructors holds a constructor for every available AI, indexed by the name returned by AI.Name.
+var aiConstructors = map[string]func() AI{
+	"BadRandomAI":          func() AI { return new(BadRandomAI) },
+	"ChristmasAI":          func() AI { return new(ChristmasAI) },
+	"EndRound":             func() AI { return new(EndRound) },
+	"HeartAI":              func() AI { return new(HeartAI) },
+	"JumpAI":               func() AI { return new(JumpAI) },
+	"JumpingLargestFreeAI": func() AI { return new(JumpingLargestFreeAI) },
+	"JumpingSnailAI":       func() AI { return new(JumpingSnailAI) },
+	"LargestFreeAI":        func() AI { return new(LargestFreeAI) },
+	"LearnedAI":            func() AI { return new(LearnedAI) },
+	"MetaAI":               func() AI { return new(MetaAI) },
+	"MirrorAI":             func() AI { return new(MirrorAI) },
+	"RandomAI":             func() AI { return new(RandomAI) },
+	"RandomAISlow":         func() AI { return new(RandomAISlow) },
+	"SnailAI":              func() AI { return new(SnailAI) },
+	"StupidAI":             func() AI { return new(StupidAI) },
+	"SuperRandomAI":        func() AI { return new(SuperRandomAI) },
+	"SuperSnailAI":         func() AI { return new(SuperSnailAI) },
+}
+
+// NewAI returns a new AI by its name. It returns nil if the AI is unknown.
+func NewAI(name string) AI {
+	c, ok := aiConstructors[name]
+	if !ok {
+		return nil
+	}
+	return c()
+}
+
+// AINames returns the names of all available AIs in sorted order.
+func AINames() []string {
+	names := make([]string, 0, len(aiConstructors))
+	for k := range aiConstructors {
+		names = append(names, k)
 	}
-	return AIArray[rand.Intn(len(AIArray))]()
+	sort.Strings(names)
+	return names
 }
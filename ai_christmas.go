@@ -17,7 +17,6 @@ package main
 
 import (
 	"log"
-	"math/rand"
 	"sync"
 )
 
@@ -56,7 +55,7 @@ func (c *ChristmasAI) GetState(g *Game) {
 	}
 
 	if c.selected == "" {
-		c.selected = ChristmasAIActions[rand.Intn(len(ChristmasAIActions))]
+		c.selected = ChristmasAIActions[g.random().Intn(len(ChristmasAIActions))]
 	}
 
 	if g.Running {
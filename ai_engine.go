@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// EngineAI uses the simulation engine with a fixed time budget for each decision.
+// It allows the engine to play local games.
+type EngineAI struct {
+	l sync.Mutex
+
+	i      chan string
+	Engine *Engine
+	Budget time.Duration
+	round  int
+}
+
+// GetChannel receives the answer channel.
+func (e *EngineAI) GetChannel(c chan string) {
+	e.l.Lock()
+	defer e.l.Unlock()
+
+	e.i = c
+}
+
+// GetState gets the game state and computes an answer.
+func (e *EngineAI) GetState(g *Game) {
+	e.l.Lock()
+	defer e.l.Unlock()
+
+	if e.i == nil {
+		return
+	}
+
+	if g.Running && g.Players[g.You].Active {
+		e.round++
+		g.PopulateInternalCellsFlat()
+
+		// Keep the same safety margin between workers and collection as the client
+		ctxWorker, ctxWorkerCancel := context.WithTimeout(context.Background(), e.Budget*4/5)
+		ctxMain, ctxMainCancel := context.WithTimeout(context.Background(), e.Budget)
+		data := newGameData(g, e.round)
+		e.Engine.Run(ctxWorker, ctxMain, g, &data)
+		ctxWorkerCancel()
+		ctxMainCancel()
+
+		data.decide(e.Engine.params())
+
+		select {
+		case e.i <- data.Action:
+		default:
+		}
+	}
+}
+
+// Name returns the name of the AI.
+func (e *EngineAI) Name() string {
+	return "EngineAI"
+}
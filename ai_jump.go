@@ -21,11 +21,6 @@ import (
 	"sync"
 )
 
-const (
-	// JumpAITries contains the number of iterations JumpAI uses to find a jump
-	JumpAITries = 100
-)
-
 const (
 	jumpAIprogressNormal = iota
 	jumpAIprogressJump
@@ -42,9 +37,10 @@ type jumpAIRevert struct {
 type JumpAI struct {
 	l sync.Mutex
 
-	i    chan string
-	plan []string
-	r    *rand.Rand
+	i     chan string
+	plan  []string
+	r     *rand.Rand
+	tries int
 }
 
 // GetChannel receives the answer channel.
@@ -114,12 +110,13 @@ func (j *JumpAI) GetState(g *Game) {
 
 		if len(j.plan) == 0 {
 			if j.r == nil {
-				j.r = rand.New(rand.NewSource(rand.Int63()))
+				j.r = rand.New(rand.NewSource(g.random().Int63()))
 			}
 
-			length := HolesEachStep - (g.Players[g.You].stepCounter % HolesEachStep)
+			length := g.rules().HolesEachStep - (g.Players[g.You].stepCounter % g.rules().HolesEachStep)
 
-			// Try finding jump
+			// Try finding jump, the number of tries is a parameter (DefaultParameters keeps the former 100 tries)
+			j.tries = g.params().JumpAITries
 			j.plan = j.findPlan(length, g.PublicCopy())
 
 			if len(j.plan) == 0 {
@@ -143,7 +140,7 @@ func (j *JumpAI) Name() string {
 }
 
 // findPlan will try to find a plan containing a jump with a maximum of length steps.
-// Function will return nil if no plan is found.
+// At most j.tries steps are tested. Function will return nil if no plan is found.
 // Not safe for concurrent use.
 func (j *JumpAI) findPlan(length int, g *Game) []string {
 	length--
@@ -154,6 +151,10 @@ func (j *JumpAI) findPlan(length int, g *Game) []string {
 	j.r.Shuffle(len(actions), func(i, j int) { actions[i], actions[j] = actions[j], actions[i] })
 
 	for i := range actions {
+		if j.tries <= 0 {
+			return nil
+		}
+		j.tries--
 		result, revert := j.progress(g, g.You, actions[i])
 		switch result {
 		case jumpAIprogressCrash:
@@ -214,7 +215,7 @@ func (j *JumpAI) progress(g *Game, player int, command string) (int, jumpAIRever
 		}
 	case ActionFaster:
 		p.Speed++
-		if p.Speed > MaxSpeed {
+		if p.Speed > g.rules().MaxSpeed {
 			return jumpAIprogressCrash, r
 		}
 	case ActionSlower:
@@ -247,7 +248,7 @@ func (j *JumpAI) progress(g *Game, player int, command string) (int, jumpAIRever
 		if p.X < 0 || p.X >= g.Width || p.Y < 0 || p.Y >= g.Height {
 			return jumpAIprogressCrash, r
 		}
-		if p.Speed >= HoleSpeed && p.stepCounter%HolesEachStep == 0 && s != 0 && s != p.Speed-1 {
+		if p.Speed >= g.rules().HoleSpeed && p.stepCounter%g.rules().HolesEachStep == 0 && s != 0 && s != p.Speed-1 {
 			if g.Cells[p.Y][p.X] != 0 {
 				jump = true
 			}
@@ -324,7 +325,7 @@ func (j *JumpAI) executePlan(g *Game, plan []string) bool {
 			}
 		case ActionFaster:
 			speed++
-			if speed > MaxSpeed {
+			if speed > g.rules().MaxSpeed {
 				return false
 			}
 		case ActionSlower:
@@ -357,7 +358,7 @@ func (j *JumpAI) executePlan(g *Game, plan []string) bool {
 			if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 				return false
 			}
-			if speed >= HoleSpeed && sc%HolesEachStep == 0 && s != 0 && s != speed-1 {
+			if speed >= g.rules().HoleSpeed && sc%g.rules().HolesEachStep == 0 && s != 0 && s != speed-1 {
 				if g.Cells[y][x] != 0 {
 					jump = true
 				}
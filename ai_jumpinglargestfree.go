@@ -19,9 +19,6 @@ import (
 	"sync"
 )
 
-// JumpingLargestFreeAIJumpAtLessThanFree is the number of free cells connected at which the AI tries to jump.
-const JumpingLargestFreeAIJumpAtLessThanFree = 50
-
 // JumpingLargestFreeAI behaves like LargestFreeAI but tries to jump out of small areas.
 type JumpingLargestFreeAI struct {
 	l sync.Mutex
@@ -63,7 +60,8 @@ func (jlf *JumpingLargestFreeAI) GetState(g *Game) {
 	}
 
 	if g.Running && g.Players[g.You].Active {
-		if jlf.freeSpaceConnected(g.Players[g.You].X, g.Players[g.You].Y, JumpingLargestFreeAIJumpAtLessThanFree+1, g) < JumpingLargestFreeAIJumpAtLessThanFree {
+		jumpAt := g.params().JumpingLargestFreeAIJumpAtLessThanFree
+		if jlf.freeSpaceConnected(g.Players[g.You].X, g.Players[g.You].Y, jumpAt+1, g) < jumpAt {
 			if jlf.jump == nil {
 				jlf.jump = new(JumpAI)
 				jlf.jump.GetChannel(jlf.i)
@@ -0,0 +1,320 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sync"
+)
+
+const (
+	// learnedAhead is the number of free cells ahead after which the feature is capped.
+	learnedAhead = 20
+	// learnedSpace is the number of reachable free cells after which the flood fill stops.
+	learnedSpace = 64
+	// learnedOpponent is the distance to the next opponent after which the feature is capped.
+	learnedOpponent = 20
+	// learnedBias is the index of the first per action bias in learnedFeatures.
+	learnedBias = 8
+)
+
+// learnedFeatures holds the names of the features of an action, in the order of the weights of LearnedModel.
+var learnedFeatures = []string{
+	"fatal",         // Action certainly crashes
+	"possiblyFatal", // An opponent can reach one of the written cells in the same step
+	"ahead",         // Free cells ahead after the action
+	"space",         // Free cells reachable after the action
+	"speed",         // Speed after the action
+	"wall",          // Distance to the wall ahead after the action
+	"opponent",      // Distance to the nearest active opponent after the action
+	"jump",          // Action jumps over an occupied cell
+	"bias_" + ActionNOOP,
+	"bias_" + ActionTurnLeft,
+	"bias_" + ActionTurnRight,
+	"bias_" + ActionFaster,
+	"bias_" + ActionSlower,
+}
+
+// LearnedModel holds the weights of the linear scores of LearnedAI.
+// The probability of an action is the softmax of the scores of all legal actions.
+type LearnedModel struct {
+	Features []string  `json:"features"`
+	Weights  []float64 `json:"weights"`
+}
+
+// DefaultLearnedModel is used by LearnedAI if no model is configured.
+// It was trained with 'sl_ow train -selfplay 400'.
+var DefaultLearnedModel = LearnedModel{
+	Features: learnedFeatures,
+	Weights:  []float64{-5.014, -0.928, 2.209, 1.88, -0.541, -0.253, 0.135, 0.972, 2.354, 0.093, 0.434, -4.217, 1.335},
+}
+
+// Validate returns an error if the model does not match the features of LearnedAI.
+func (m *LearnedModel) Validate() error {
+	if len(m.Features) != len(learnedFeatures) || len(m.Weights) != len(learnedFeatures) {
+		return fmt.Errorf("model has %d features and %d weights, need %d", len(m.Features), len(m.Weights), len(learnedFeatures))
+	}
+	for i := range m.Features {
+		if m.Features[i] != learnedFeatures[i] {
+			return fmt.Errorf("unknown feature %s at position %d (expected %s)", m.Features[i], i, learnedFeatures[i])
+		}
+	}
+	return nil
+}
+
+// score returns the linear score of a feature vector.
+func (m *LearnedModel) score(f []float64) float64 {
+	s := 0.0
+	for i := range f {
+		s += m.Weights[i] * f[i]
+	}
+	return s
+}
+
+// probabilities returns the softmax probabilities of the feature vectors of several actions.
+func (m *LearnedModel) probabilities(features [][]float64) []float64 {
+	p := make([]float64, len(features))
+	max := math.Inf(-1)
+	for i := range features {
+		p[i] = m.score(features[i])
+		if p[i] > max {
+			max = p[i]
+		}
+	}
+	sum := 0.0
+	for i := range p {
+		p[i] = math.Exp(p[i] - max)
+		sum += p[i]
+	}
+	for i := range p {
+		p[i] /= sum
+	}
+	return p
+}
+
+// loadLearnedModel reads a model from a JSON file.
+func loadLearnedModel(file string) (*LearnedModel, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var m LearnedModel
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return nil, err
+	}
+	return &m, m.Validate()
+}
+
+// saveLearnedModel writes a model as JSON to a file.
+func saveLearnedModel(file string, m *LearnedModel) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(b, '\n'), 0644)
+}
+
+// model returns the learned model of the game parameters or DefaultLearnedModel if none is set.
+func (g *Game) model() *LearnedModel {
+	if p := g.params(); p.LearnedModel != nil {
+		return p.LearnedModel
+	}
+	return &DefaultLearnedModel
+}
+
+// learnedActionFeatures returns the features of all legal actions of the own player.
+func (g *Game) learnedActionFeatures() ([]string, [][]float64) {
+	var opponents [][2]int
+	reachable := make([]bool, g.Width*g.Height)
+	for i, p := range g.Players {
+		if i == g.You || !p.Active {
+			continue
+		}
+		opponents = append(opponents, [2]int{p.X, p.Y})
+		for _, a := range []string{ActionTurnLeft, ActionTurnRight, ActionSlower, ActionFaster, ActionNOOP} {
+			cells, _ := g.moveCells(i, a)
+			for _, c := range cells {
+				reachable[c[1]*g.Width+c[0]] = true
+			}
+		}
+	}
+
+	actions := g.legalActions()
+	features := make([][]float64, len(actions))
+	visited := make([]bool, g.Width*g.Height)
+	for i, a := range actions {
+		features[i] = g.learnedFeatures(a, reachable, visited, opponents)
+	}
+	return actions, features
+}
+
+// learnedFeatures returns the features of an action of the own player.
+// reachable marks all cells opponents can write in the next step (indexed by y*Width+x), opponents holds the positions of all active opponents.
+// visited is used as scratch space of the same size and must be all false. It is all false again after the call.
+func (g *Game) learnedFeatures(action string, reachable, visited []bool, opponents [][2]int) []float64 {
+	f := make([]float64, len(learnedFeatures))
+	for i, name := range learnedFeatures[learnedBias:] {
+		if name == "bias_"+action {
+			f[learnedBias+i] = 1
+		}
+	}
+
+	p := g.Players[g.You]
+	cells, ok := g.moveCells(g.You, action)
+	if !ok || len(cells) == 0 {
+		f[0] = 1
+		return f
+	}
+	// Written cells are marked as visited so that they do not count as free
+	for _, c := range cells {
+		if g.Cells[c[1]][c[0]] != 0 {
+			f[0] = 1
+		}
+		if reachable[c[1]*g.Width+c[0]] {
+			f[1] = 1
+		}
+		visited[c[1]*g.Width+c[0]] = true
+	}
+	defer func() {
+		for _, c := range cells {
+			visited[c[1]*g.Width+c[0]] = false
+		}
+	}()
+
+	end := cells[len(cells)-1]
+	dx, dy := sign(end[0]-p.X), sign(end[1]-p.Y)
+	speed := abs(end[0]-p.X) + abs(end[1]-p.Y)
+	f[4] = float64(speed) / float64(g.rules().MaxSpeed)
+
+	// Skipped cells of holes
+	for s := 1; s < speed; s++ {
+		c := [2]int{p.X + s*dx, p.Y + s*dy}
+		if !visited[c[1]*g.Width+c[0]] && g.Cells[c[1]][c[0]] != 0 {
+			f[7] = 1
+			break
+		}
+	}
+
+	free := func(x, y int) bool {
+		return x >= 0 && x < g.Width && y >= 0 && y < g.Height && g.Cells[y][x] == 0 && !visited[y*g.Width+x]
+	}
+
+	ahead := 0
+	for x, y := end[0]+dx, end[1]+dy; ahead < learnedAhead && free(x, y); x, y = x+dx, y+dy {
+		ahead++
+	}
+	f[2] = float64(ahead) / learnedAhead
+
+	wall := 0
+	for x, y := end[0]+dx, end[1]+dy; x >= 0 && x < g.Width && y >= 0 && y < g.Height; x, y = x+dx, y+dy {
+		wall++
+	}
+	size := g.Width
+	if g.Height > size {
+		size = g.Height
+	}
+	f[5] = float64(wall) / float64(size)
+
+	// Flood fill from the end position, all seen cells stay in queue
+	queue := make([][2]int, 1, learnedSpace+4)
+	queue[0] = end
+	for next := 0; next < len(queue) && len(queue) <= learnedSpace; next++ {
+		c := queue[next]
+		for _, n := range [4][2]int{{c[0] - 1, c[1]}, {c[0] + 1, c[1]}, {c[0], c[1] - 1}, {c[0], c[1] + 1}} {
+			if free(n[0], n[1]) {
+				visited[n[1]*g.Width+n[0]] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+	for _, c := range queue[1:] {
+		visited[c[1]*g.Width+c[0]] = false
+	}
+	space := len(queue) - 1
+	if space > learnedSpace {
+		space = learnedSpace
+	}
+	f[3] = float64(space) / learnedSpace
+
+	distance := learnedOpponent
+	for _, o := range opponents {
+		if d := abs(o[0]-end[0]) + abs(o[1]-end[1]); d < distance {
+			distance = d
+		}
+	}
+	f[6] = float64(distance) / learnedOpponent
+	return f
+}
+
+func sign(x int) int {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	}
+	return 0
+}
+
+// LearnedAI samples its actions from a learned softmax policy over features of the actions (see 'sl_ow train').
+// The model is taken from the parameters of the game, DefaultLearnedModel if none is set.
+type LearnedAI struct {
+	l sync.Mutex
+	i chan string
+}
+
+// GetChannel receives the answer channel.
+func (l *LearnedAI) GetChannel(c chan string) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	l.i = c
+}
+
+// GetState gets the game state and computes an answer.
+func (l *LearnedAI) GetState(g *Game) {
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	if l.i == nil || !g.Running || !g.Players[g.You].Active {
+		return
+	}
+
+	actions, features := g.learnedActionFeatures()
+	p := g.model().probabilities(features)
+	action := actions[len(actions)-1]
+	r := g.random().Float64()
+	for i := range p {
+		r -= p[i]
+		if r < 0 {
+			action = actions[i]
+			break
+		}
+	}
+
+	select {
+	case l.i <- action:
+	default:
+	}
+}
+
+// Name returns the name of the AI.
+func (l *LearnedAI) Name() string {
+	return "LearnedAI"
+}
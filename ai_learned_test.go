@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// learnedTestGame returns a 10x10 board. Player 1 is at (2,5) going right with speed 2 in the round before a hole,
+// (4,5) is occupied and player 2 is at (3,3) going up.
+func learnedTestGame() *Game {
+	g := &Game{
+		Width:   10,
+		Height:  10,
+		Cells:   make([][]int8, 10),
+		You:     1,
+		Running: true,
+		Players: map[int]*Player{
+			1: {X: 2, Y: 5, Direction: DirectionRight, Speed: 2, Active: true, stepCounter: 5},
+			2: {X: 3, Y: 3, Direction: DirectionUp, Speed: 1, Active: true, stepCounter: 5},
+		},
+	}
+	for y := range g.Cells {
+		g.Cells[y] = make([]int8, g.Width)
+	}
+	g.Cells[5][2] = 1
+	g.Cells[5][4] = 2
+	g.Cells[3][3] = 2
+	return g
+}
+
+func TestLearnedFeatures(t *testing.T) {
+	g := learnedTestGame()
+	actions, features := g.learnedActionFeatures()
+	byAction := make(map[string][]float64)
+	for i := range actions {
+		byAction[actions[i]] = features[i]
+	}
+
+	tests := []struct {
+		action  string
+		feature string
+		value   float64
+	}{
+		{ActionNOOP, "fatal", 1},
+		{ActionFaster, "fatal", 0},
+		{ActionFaster, "jump", 1},
+		{ActionFaster, "speed", 0.3},
+		{ActionTurnLeft, "fatal", 0},
+		{ActionTurnLeft, "jump", 0},
+		{ActionTurnLeft, "possiblyFatal", 1},
+		{ActionTurnLeft, "ahead", 3.0 / learnedAhead},
+		{ActionTurnLeft, "wall", 0.3},
+		{ActionTurnLeft, "space", 1},
+		{ActionTurnLeft, "opponent", 1.0 / learnedOpponent},
+		{ActionTurnLeft, "bias_" + ActionTurnLeft, 1},
+		{ActionTurnLeft, "bias_" + ActionNOOP, 0},
+		{ActionTurnRight, "possiblyFatal", 0},
+		{ActionTurnRight, "ahead", 2.0 / learnedAhead},
+	}
+	for _, tt := range tests {
+		f, ok := byAction[tt.action]
+		if !ok {
+			t.Fatalf("action %s missing", tt.action)
+		}
+		found := false
+		for i, name := range learnedFeatures {
+			if name != tt.feature {
+				continue
+			}
+			found = true
+			if math.Abs(f[i]-tt.value) > 1e-9 {
+				t.Errorf("%s: %s is %f, want %f", tt.action, tt.feature, f[i], tt.value)
+			}
+		}
+		if !found {
+			t.Errorf("unknown feature %s", tt.feature)
+		}
+	}
+}
+
+func TestLearnedProbabilities(t *testing.T) {
+	m := &LearnedModel{Features: learnedFeatures, Weights: make([]float64, len(learnedFeatures))}
+	m.Weights[0] = -1000
+	m.Weights[2] = 1000
+	features := [][]float64{
+		make([]float64, len(learnedFeatures)),
+		make([]float64, len(learnedFeatures)),
+		make([]float64, len(learnedFeatures)),
+	}
+	features[0][0] = 1
+	features[1][2] = 0.5
+	features[2][2] = 0.501
+
+	p := m.probabilities(features)
+	sum := 0.0
+	for i := range p {
+		if math.IsNaN(p[i]) || p[i] < 0 || p[i] > 1 {
+			t.Fatalf("invalid probability %f", p[i])
+		}
+		sum += p[i]
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("probabilities sum to %f", sum)
+	}
+	if !(p[0] < p[1] && p[1] < p[2]) {
+		t.Errorf("probabilities %v do not follow the scores", p)
+	}
+
+	// Equal scores result in a uniform distribution
+	p = (&LearnedModel{Features: learnedFeatures, Weights: make([]float64, len(learnedFeatures))}).probabilities(features)
+	for i := range p {
+		if math.Abs(p[i]-1.0/3) > 1e-9 {
+			t.Errorf("probability %d is %f, want 1/3", i, p[i])
+		}
+	}
+}
+
+func TestTrainModelGradient(t *testing.T) {
+	_, features := learnedTestGame().learnedActionFeatures()
+	sample := trainSample{features: features, label: 1}
+	weights := []float64{-1, 0.5, 0.3, 0.2, -0.4, 0.1, 0.2, 0.3, 0.1, -0.1, 0.2, 0, 0.05}
+
+	logLikelihood := func(w []float64) float64 {
+		m := &LearnedModel{Features: learnedFeatures, Weights: w}
+		return math.Log(m.probabilities(sample.features)[sample.label])
+	}
+
+	const rate, epsilon = 0.001, 1e-6
+	m := &LearnedModel{Features: learnedFeatures, Weights: append([]float64(nil), weights...)}
+	trainModel(m, []trainSample{sample}, 1, rate, 0)
+	for i := range weights {
+		plus := append([]float64(nil), weights...)
+		minus := append([]float64(nil), weights...)
+		plus[i] += epsilon
+		minus[i] -= epsilon
+		numerical := (logLikelihood(plus) - logLikelihood(minus)) / (2 * epsilon)
+		analytical := (m.Weights[i] - weights[i]) / rate
+		if math.Abs(numerical-analytical) > 1e-5 {
+			t.Errorf("weight %s: gradient %f, numerical %f", learnedFeatures[i], analytical, numerical)
+		}
+	}
+}
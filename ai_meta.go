@@ -16,7 +16,6 @@
 package main
 
 import (
-	"math/rand"
 	"sync"
 )
 
@@ -46,7 +45,7 @@ func (meta *MetaAI) GetState(g *Game) {
 	}
 
 	if g.Running {
-		if rand.Float64() < 0.1 {
+		if g.random().Float64() < g.params().MetaAISwitchProbability {
 			meta.ai = nil
 		}
 
@@ -155,7 +154,7 @@ func (meta *MetaAI) GetState(g *Game) {
 				return
 			}
 			ais := []AI{&LargestFreeAI{}, &SuperSnailAI{}, &StupidAI{}, &RandomAISlow{}}
-			meta.ai = ais[rand.Intn(len(ais))]
+			meta.ai = ais[g.random().Intn(len(ais))]
 			meta.ai.GetChannel(meta.i)
 		}
 
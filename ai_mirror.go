@@ -16,7 +16,6 @@
 package main
 
 import (
-	"math/rand"
 	"sync"
 )
 
@@ -63,7 +62,12 @@ func (m *MirrorAI) GetState(g *Game) {
 					player = append(player, k)
 				}
 			}
-			m.target = player[rand.Intn(len(player))]
+			if len(player) == 0 {
+				// Nobody left to mirror
+				m.i <- ActionNOOP
+				return
+			}
+			m.target = player[g.random().Intn(len(player))]
 
 			// Save data
 			m.targetDirection = g.Players[m.target].Direction
@@ -82,7 +86,7 @@ func (m *MirrorAI) GetState(g *Game) {
 		// Faster
 		case g.Players[m.target].Speed > m.targetSpeed:
 			m.targetSpeed = g.Players[m.target].Speed
-			if g.Players[g.You].Speed < 10 {
+			if g.Players[g.You].Speed < g.rules().MaxSpeed {
 				action = ActionFaster
 			}
 
@@ -17,7 +17,6 @@ package main
 
 import (
 	"log"
-	"math/rand"
 	"sync"
 )
 
@@ -88,7 +87,7 @@ func (r *RandomAISlow) GetState(g *Game) {
 
 		// actions
 		actions := []string{ActionTurnLeft, ActionTurnRight, ActionNOOP, ActionNOOP, ActionNOOP, ActionNOOP, ActionNOOP, ActionNOOP, ActionNOOP, ActionNOOP}
-		rand.Shuffle(len(actions), func(i, j int) { actions[i], actions[j] = actions[j], actions[i] })
+		g.random().Shuffle(len(actions), func(i, j int) { actions[i], actions[j] = actions[j], actions[i] })
 		fallbackAction := ""
 
 		// test actions
@@ -119,7 +118,7 @@ func (r *RandomAISlow) GetState(g *Game) {
 				}
 			case ActionFaster:
 				g.Players[g.You].Speed++
-				if g.Players[g.You].Speed > MaxSpeed {
+				if g.Players[g.You].Speed > g.rules().MaxSpeed {
 					g.Players[g.You].Speed--
 					continue
 				}
@@ -222,7 +221,7 @@ func (r *RandomAISlow) willCrash(g *Game) int {
 		if g.Players[g.You].X < 0 || g.Players[g.You].X >= g.Width || g.Players[g.You].Y < 0 || g.Players[g.You].Y >= g.Height {
 			return randomAISureCrash
 		}
-		if g.Players[g.You].Speed >= HoleSpeed && (g.Players[g.You].stepCounter+1)%HolesEachStep == 0 && s != 0 && s != g.Players[g.You].Speed-1 {
+		if g.Players[g.You].Speed >= g.rules().HoleSpeed && (g.Players[g.You].stepCounter+1)%g.rules().HolesEachStep == 0 && s != 0 && s != g.Players[g.You].Speed-1 {
 			continue
 		}
 		if g.Cells[g.Players[g.You].Y][g.Players[g.You].X] == -100 {
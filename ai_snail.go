@@ -16,7 +16,6 @@
 package main
 
 import (
-	"math/rand"
 	"sync"
 )
 
@@ -45,7 +44,7 @@ func (s *SnailAI) GetState(g *Game) {
 	}
 
 	if s.direction == "" {
-		if rand.Float32() < 0.5 {
+		if g.random().Float32() < 0.5 {
 			s.direction = DirectionLeft
 		} else {
 			s.direction = DirectionRight
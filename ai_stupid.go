@@ -16,7 +16,6 @@
 package main
 
 import (
-	"math/rand"
 	"sync"
 )
 
@@ -52,7 +51,7 @@ func (s *StupidAI) GetState(g *Game) {
 			return
 		}
 
-		if rand.Float64() < 0.5 {
+		if g.random().Float64() < 0.5 {
 
 			// Turn left
 			switch p.Direction {
@@ -17,14 +17,9 @@ package main
 
 import (
 	"log"
-	"math/rand"
 	"sync"
 )
 
-const (
-	superRandomAIPathLength = HolesEachStep * 2
-)
-
 type superSnailAIRevert struct {
 	X, Y, Speed, stepCounter int
 	Direction                string
@@ -99,6 +94,7 @@ func (sr *SuperRandomAI) GetState(g *Game) {
 
 		action := ""
 		best := 0
+		pathLength := g.rules().HolesEachStep * 2
 
 		// Try finding best action
 		actions := make([]string, 0, 5)
@@ -110,7 +106,7 @@ func (sr *SuperRandomAI) GetState(g *Game) {
 		if g.Players[g.You].Speed < 5 {
 			actions = append(actions, ActionFaster)
 		}
-		rand.Shuffle(len(actions), func(i, j int) { actions[i], actions[j] = actions[j], actions[i] })
+		g.random().Shuffle(len(actions), func(i, j int) { actions[i], actions[j] = actions[j], actions[i] })
 
 		for a := range actions {
 			b, r := sr.progress(g, g.You, actions[a])
@@ -118,12 +114,12 @@ func (sr *SuperRandomAI) GetState(g *Game) {
 				sr.revert(g, g.You, r)
 				continue
 			}
-			try := sr.getLength(superRandomAIPathLength, g)
+			try := sr.getLength(pathLength, g)
 			sr.revert(g, g.You, r)
 			if try > best {
 				best = try
 				action = actions[a]
-				if try == superRandomAIPathLength {
+				if try == pathLength {
 					break
 				}
 			}
@@ -218,7 +214,7 @@ func (sr *SuperRandomAI) progress(g *Game, player int, command string) (bool, su
 		}
 	case ActionFaster:
 		p.Speed++
-		if p.Speed > MaxSpeed {
+		if p.Speed > g.rules().MaxSpeed {
 			return false, r
 		}
 	case ActionSlower:
@@ -251,7 +247,7 @@ func (sr *SuperRandomAI) progress(g *Game, player int, command string) (bool, su
 		if p.X < 0 || p.X >= g.Width || p.Y < 0 || p.Y >= g.Height {
 			return false, r
 		}
-		if p.Speed >= HoleSpeed && p.stepCounter%HolesEachStep == 0 && s != 0 && s != p.Speed-1 {
+		if p.Speed >= g.rules().HoleSpeed && p.stepCounter%g.rules().HolesEachStep == 0 && s != 0 && s != p.Speed-1 {
 			continue
 		}
 		if g.Cells[p.Y][p.X] != 0 {
@@ -17,7 +17,6 @@ package main
 
 import (
 	"log"
-	"math/rand"
 	"sync"
 )
 
@@ -54,7 +53,7 @@ func (s *SuperSnailAI) GetState(g *Game) {
 	}
 
 	if s.direction == "" {
-		if rand.Float32() < 0.5 {
+		if g.random().Float32() < 0.5 {
 			s.direction = DirectionLeft
 		} else {
 			s.direction = DirectionRight
@@ -249,7 +248,7 @@ func (s *SuperSnailAI) progress(g *Game, player int, command string) (bool, supe
 		}
 	case ActionFaster:
 		p.Speed++
-		if p.Speed > MaxSpeed {
+		if p.Speed > g.rules().MaxSpeed {
 			return false, r
 		}
 	case ActionSlower:
@@ -285,7 +284,7 @@ func (s *SuperSnailAI) progress(g *Game, player int, command string) (bool, supe
 		if p.X < 0 || p.X >= g.Width || p.Y < 0 || p.Y >= g.Height {
 			return false, r
 		}
-		if p.Speed >= HoleSpeed && p.stepCounter%HolesEachStep == 0 && s != 0 && s != p.Speed-1 {
+		if p.Speed >= g.rules().HoleSpeed && p.stepCounter%g.rules().HolesEachStep == 0 && s != 0 && s != p.Speed-1 {
 			continue
 		}
 		if g.Cells[p.Y][p.X] != 0 {
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"text/tabwriter"
+	"time"
+)
+
+// analyzeDecision re-runs the engine on a recorded game state and returns the new decision.
+// With Engine.Seed, MaxRuns and a single worker, the decision can be reproduced for every round on its own.
+func analyzeDecision(engine *Engine, recorded GameData, budget time.Duration) GameData {
+	g := recorded.Game.PublicCopy()
+	g.PopulateInternalCellsFlat()
+
+	data := newGameData(g, recorded.Round)
+	ctxWorker, ctxWorkerCancel := context.WithTimeout(context.Background(), budget*4/5)
+	ctxMain, ctxMainCancel := context.WithTimeout(context.Background(), budget)
+	engine.Run(ctxWorker, ctxMain, g, &data)
+	ctxWorkerCancel()
+	ctxMainCancel()
+	data.decide(engine.params())
+	return data
+}
+
+// writeActionComparison writes the per-action statistics of the recorded and the new decision.
+func writeActionComparison(out io.Writer, recorded, current GameData) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "\taction\tsafety\trecorded run\trecorded win\trecorded length\tnew run\tnew win\tnew length\t")
+	for _, action := range []string{ActionNOOP, ActionSlower, ActionFaster, ActionTurnLeft, ActionTurnRight} {
+		marker := ""
+		if action == recorded.Action {
+			marker += "r"
+		}
+		if action == current.Action {
+			marker += "n"
+		}
+		r, n := recorded.Collect[action], current.Collect[action]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%.2f\t%.1f\t%d\t%.2f\t%.1f\t\n",
+			marker, action, current.Safety[action],
+			r.Run, r.WinChance(), r.AverageLength(),
+			n.Run, n.WinChance(), n.AverageLength(),
+		)
+	}
+	w.Flush()
+}
+
+// analyzeCommand re-runs the engine on all rounds of a dump and reports different decisions.
+func analyzeCommand(args []string) {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	budget := fs.Duration("budget", time.Second, "Computation time of the engine per round")
+	runs := fs.Int("runs", 0, "Stop each decision after this number of simulations, 0 only uses the budget")
+	seed := fs.Int64("seed", 1, "Seed of the simulations, 0 for a random seed")
+	workers := fs.Int("workers", runtime.NumCPU(), "Number of simulation workers, results are only reproducible with 1 worker together with -runs")
+	rollout := fs.String("rollout", "", "AI used in the simulations (default SuperRandomAI)")
+	paramsFile := fs.String("params", "", "Loads decision and AI parameters from file")
+	all := fs.Bool("all", false, "Report all rounds, not only different decisions")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: sl_ow analyze [flags] dump")
+		fmt.Fprintln(fs.Output(), "Re-runs the engine on every round of a dump (see -dump) and reports rounds where the decision differs.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *workers < 1 || *budget <= 0 || *runs < 0 {
+		log.Fatalln("workers must be at least 1, budget positive and runs not negative")
+	}
+	if *rollout != "" && NewAI(*rollout) == nil {
+		log.Fatalln("unknown rollout ai", *rollout)
+	}
+
+	parameters := DefaultParameters
+	if *paramsFile != "" {
+		var err error
+		parameters, err = loadParameters(*paramsFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	states, err := loadDump(fs.Arg(0))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	engine := &Engine{Workers: *workers, Rollout: *rollout, Parameters: &parameters, MaxRuns: *runs, Seed: *seed}
+	analysed, different := 0, 0
+	for _, recorded := range states {
+		if !recorded.Alive || recorded.Game == nil || recorded.Action == "" || recorded.Action == "nothing" {
+			continue
+		}
+		analysed++
+		current := analyzeDecision(engine, recorded, *budget)
+		if current.Action == recorded.Action && !*all {
+			continue
+		}
+		if current.Action != recorded.Action {
+			different++
+		}
+		fmt.Printf("round %d: recorded %s (%s), new %s (%s)\n", recorded.Round, recorded.Action, recorded.Reason, current.Action, current.Reason)
+		writeActionComparison(os.Stdout, recorded, current)
+		fmt.Println()
+	}
+	fmt.Printf("%d rounds analysed, %d different decisions\n", analysed, different)
+}
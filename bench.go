@@ -0,0 +1,269 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// benchGenerateTries is the number of games played to reach the usage of a generated position.
+	benchGenerateTries = 100
+)
+
+// benchPhases holds the board usage of the generated early, mid and late game positions.
+var benchPhases = []struct {
+	Name  string
+	Usage float64
+}{
+	{"early", 0.02},
+	{"mid", 0.2},
+	{"late", 0.4},
+}
+
+// benchPosition is a named game state used in benchmarks.
+type benchPosition struct {
+	Name string
+	Game *Game
+}
+
+// benchResult holds the result of a single measurement.
+type benchResult struct {
+	Ops     int
+	Elapsed time.Duration
+	Max     time.Duration
+	Allocs  uint64
+	Bytes   uint64
+}
+
+// benchPositionAIs are the AIs playing the games of generatePosition.
+// The list is fixed so that positions do not change with the rotation of GetAI.
+var benchPositionAIs = []string{"LargestFreeAI", "SnailAI", "SuperSnailAI", "JumpingSnailAI", "RandomAI"}
+
+// generatePosition plays local games with the AIs of benchPositionAIs until the given share of the board is used.
+// The player with the most free space connected is selected as You.
+// If the usage can not be reached, the position with the highest usage is returned.
+func generatePosition(width, height, players int, usage float64) *Game {
+	var best *Game
+	bestUsage := -1.0
+
+	for try := 0; try < benchGenerateTries; try++ {
+		g := newGame(width, height, players)
+		for k := range g.Players {
+			g.Players[k].ai = NewAI(benchPositionAIs[(k-1)%len(benchPositionAIs)])
+		}
+
+		var last *Game
+		for g.Running {
+			last = g.PublicCopy()
+			if 1.0-g.usage(0) >= usage {
+				break
+			}
+			g.advance()
+		}
+		if last == nil || last.checkEndGame() {
+			continue
+		}
+
+		lastUsage := 1.0 - last.usage(0)
+		if lastUsage > bestUsage {
+			best = last
+			bestUsage = lastUsage
+		}
+		if lastUsage >= usage {
+			break
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+
+	free := -1
+	for k := range best.Players {
+		if !best.Players[k].Active {
+			continue
+		}
+		f := best.freeSpaceConnected(best.Players[k].X, best.Players[k].Y, -1)
+		if f > free {
+			free = f
+			best.You = k
+		}
+	}
+	best.Running = true
+	best.PopulateInternalCellsFlat()
+	return best
+}
+
+// generateBenchPositions returns one generated position for each entry of benchPhases.
+func generateBenchPositions(width, height, players int) []benchPosition {
+	positions := make([]benchPosition, 0, len(benchPhases))
+	for _, phase := range benchPhases {
+		g := generatePosition(width, height, players, phase.Usage)
+		if g == nil {
+			log.Printf("bench: can not generate %s position", phase.Name)
+			continue
+		}
+		positions = append(positions, benchPosition{Name: phase.Name, Game: g})
+	}
+	return positions
+}
+
+// measure runs f repeatedly for at least d and reports the number of runs, the time and the allocations.
+// f must not start other goroutines since allocations are counted for the whole process.
+func measure(d time.Duration, f func()) benchResult {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	r := benchResult{}
+	start := time.Now()
+	for r.Ops == 0 || time.Since(start) < d {
+		s := time.Now()
+		f()
+		t := time.Since(s)
+		if t > r.Max {
+			r.Max = t
+		}
+		r.Ops++
+	}
+	r.Elapsed = time.Since(start)
+
+	runtime.ReadMemStats(&after)
+	r.Allocs = after.Mallocs - before.Mallocs
+	r.Bytes = after.TotalAlloc - before.TotalAlloc
+	return r
+}
+
+// benchSimulateGame measures single threaded rollouts of g with the given rollout AI.
+func benchSimulateGame(g *Game, rollout string, d time.Duration) benchResult {
+	results := make(chan struct {
+		action            string
+		win               bool
+		survived          int
+		survivdedOpponent int
+		round             int
+	}, 1)
+	actions := []string{ActionTurnLeft, ActionTurnRight, ActionSlower, ActionFaster, ActionNOOP}
+	i := 0
+	return measure(d, func() {
+		ng := g.PublicCopy()
+		ng.rollout = aiConstructors[rollout]
+		ng.SimulateGame(actions[i%len(actions)], results)
+		<-results
+		i++
+	})
+}
+
+// benchGetState measures a single decision of a new instance of the given AI on g.
+func benchGetState(g *Game, ai string, d time.Duration) benchResult {
+	answer := make(chan string, 1)
+	return measure(d, func() {
+		a := NewAI(ai)
+		a.GetChannel(answer)
+		a.GetState(g.PublicCopy())
+		select {
+		case <-answer:
+		default:
+		}
+	})
+}
+
+// benchCommand measures the throughput of the engine and the AIs and prints a table which can be compared between commits.
+func benchCommand(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	seed := fs.Int64("seed", 1, "Seed used to generate positions")
+	duration := fs.Duration("duration", 1*time.Second, "Minimal duration of each measurement")
+	size := fs.Int("size", 60, "Width and height of generated positions")
+	players := fs.Int("players", 6, "Number of players of generated positions")
+	dumps := fs.String("dumps", "", "Comma separated list of dumps (see -dump) to load additional positions from")
+	every := fs.Int("every", 50, "Only use every n-th round of a dump")
+	ais := fs.String("ais", strings.Join(AINames(), ","), "Comma separated list of AIs to measure")
+	fs.Parse(args)
+
+	if *every < 1 {
+		log.Fatalln("every must be at least 1")
+	}
+
+	aiList := strings.Split(*ais, ",")
+	for i := range aiList {
+		aiList[i] = strings.TrimSpace(aiList[i])
+		if NewAI(aiList[i]) == nil {
+			log.Fatalf("unknown ai %s (available: %s)", aiList[i], strings.Join(AINames(), ", "))
+		}
+	}
+
+	rand.Seed(*seed)
+	positions := generateBenchPositions(*size, *size, *players)
+
+	if *dumps != "" {
+		for _, file := range strings.Split(*dumps, ",") {
+			gameStates, err := loadDump(strings.TrimSpace(file))
+			if err != nil {
+				log.Fatalln(err)
+			}
+			for i := range gameStates {
+				if !gameStates[i].Alive || gameStates[i].Game == nil || gameStates[i].Round%*every != 0 {
+					continue
+				}
+				positions = append(positions, benchPosition{
+					Name: fmt.Sprintf("%s:%d", filepath.Base(file), gameStates[i].Round),
+					Game: gameStates[i].Game,
+				})
+			}
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "position\tbenchmark\tai\tops\tops/s\tns/op\tmax ns\tallocs/op\tB/op\t")
+	row := func(position, benchmark, ai string, r benchResult) {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%.1f\t%d\t%d\t%d\t%d\t\n",
+			position,
+			benchmark,
+			ai,
+			r.Ops,
+			float64(r.Ops)/r.Elapsed.Seconds(),
+			r.Elapsed.Nanoseconds()/int64(r.Ops),
+			r.Max.Nanoseconds(),
+			r.Allocs/uint64(r.Ops),
+			r.Bytes/uint64(r.Ops),
+		)
+	}
+
+	for _, p := range positions {
+		g := p.Game
+		row(p.Name, "PublicCopy", "-", measure(*duration, func() { g.PublicCopy() }))
+		ng := g.PublicCopy()
+		x, y := g.Players[g.You].X, g.Players[g.You].Y
+		row(p.Name, "freeSpaceConnected", "-", measure(*duration, func() { ng.freeSpaceConnected(x, y, -1) }))
+		for _, ai := range aiList {
+			row(p.Name, "SimulateGame", ai, benchSimulateGame(g, ai, *duration))
+		}
+		for _, ai := range aiList {
+			row(p.Name, "GetState", ai, benchGetState(g, ai, *duration))
+		}
+	}
+	w.Flush()
+}
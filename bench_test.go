@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+var (
+	benchmarkPositionsOnce sync.Once
+	benchmarkPositions     []benchPosition
+)
+
+func getBenchmarkPositions(b *testing.B) []benchPosition {
+	benchmarkPositionsOnce.Do(func() {
+		rand.Seed(1)
+		benchmarkPositions = generateBenchPositions(60, 60, 6)
+	})
+	if len(benchmarkPositions) == 0 {
+		b.Fatal("no positions generated")
+	}
+	return benchmarkPositions
+}
+
+func BenchmarkPublicCopy(b *testing.B) {
+	for _, p := range getBenchmarkPositions(b) {
+		g := p.Game
+		b.Run(p.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				g.PublicCopy()
+			}
+		})
+	}
+}
+
+func BenchmarkFreeSpaceConnected(b *testing.B) {
+	for _, p := range getBenchmarkPositions(b) {
+		g := p.Game.PublicCopy()
+		x, y := g.Players[g.You].X, g.Players[g.You].Y
+		b.Run(p.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				g.freeSpaceConnected(x, y, -1)
+			}
+		})
+	}
+}
+
+func BenchmarkSimulateGame(b *testing.B) {
+	results := make(chan struct {
+		action            string
+		win               bool
+		survived          int
+		survivdedOpponent int
+		round             int
+	}, 1)
+	actions := []string{ActionTurnLeft, ActionTurnRight, ActionSlower, ActionFaster, ActionNOOP}
+	for _, p := range getBenchmarkPositions(b) {
+		for _, ai := range AINames() {
+			g := p.Game
+			rollout := aiConstructors[ai]
+			b.Run(p.Name+"/"+ai, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					ng := g.PublicCopy()
+					ng.rollout = rollout
+					ng.SimulateGame(actions[i%len(actions)], results)
+					<-results
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkGetState(b *testing.B) {
+	answer := make(chan string, 1)
+	for _, p := range getBenchmarkPositions(b) {
+		for _, ai := range AINames() {
+			g := p.Game
+			name := ai
+			b.Run(p.Name+"/"+ai, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					a := NewAI(name)
+					a.GetChannel(answer)
+					a.GetState(g.PublicCopy())
+					select {
+					case <-answer:
+					default:
+					}
+				}
+			})
+		}
+	}
+}
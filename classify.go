@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Safety classifies the outcome of the first step of an action.
+type Safety int8
+
+const (
+	// SafetySafe means the action survives the next step regardless of the opponents.
+	SafetySafe Safety = iota
+	// SafetyPossiblyFatal means an opponent might move into a cell used by the action in the next step.
+	SafetyPossiblyFatal
+	// SafetyFatal means the action certainly crashes in the next step.
+	SafetyFatal
+)
+
+// String returns a human readable name of the classification.
+func (s Safety) String() string {
+	switch s {
+	case SafetySafe:
+		return "safe"
+	case SafetyPossiblyFatal:
+		return "possibly fatal"
+	case SafetyFatal:
+		return "fatal"
+	}
+	return "unknown"
+}
+
+// moveCells returns all cells written by player i in the next step if the action is taken.
+// ok is false if the action is invalid or the player leaves the board. In that case, cells contains all cells written before.
+func (g *Game) moveCells(i int, action string) (cells [][2]int, ok bool) {
+	p := g.Players[i]
+	direction, speed := p.Direction, p.Speed
+	switch action {
+	case ActionTurnLeft:
+		switch direction {
+		case DirectionLeft:
+			direction = DirectionDown
+		case DirectionRight:
+			direction = DirectionUp
+		case DirectionUp:
+			direction = DirectionLeft
+		case DirectionDown:
+			direction = DirectionRight
+		}
+	case ActionTurnRight:
+		switch direction {
+		case DirectionLeft:
+			direction = DirectionUp
+		case DirectionRight:
+			direction = DirectionDown
+		case DirectionUp:
+			direction = DirectionRight
+		case DirectionDown:
+			direction = DirectionLeft
+		}
+	case ActionFaster:
+		speed++
+		if speed > g.rules().MaxSpeed {
+			return nil, false
+		}
+	case ActionSlower:
+		speed--
+		if speed < 1 {
+			return nil, false
+		}
+	case ActionNOOP:
+		// Do nothing
+	default:
+		return nil, false
+	}
+
+	dx, dy := 0, 0
+	switch direction {
+	case DirectionUp:
+		dy = -1
+	case DirectionDown:
+		dy = 1
+	case DirectionLeft:
+		dx = -1
+	case DirectionRight:
+		dx = 1
+	}
+
+	stepCounter := p.stepCounter + 1
+	x, y := p.X, p.Y
+	cells = make([][2]int, 0, speed)
+	for s := 0; s < speed; s++ {
+		x, y = x+dx, y+dy
+		if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
+			return cells, false
+		}
+		if speed >= g.rules().HoleSpeed && stepCounter%g.rules().HolesEachStep == 0 && s != 0 && s != speed-1 {
+			continue
+		}
+		cells = append(cells, [2]int{x, y})
+	}
+	return cells, true
+}
+
+// classifyAction returns the classification of an action of the own player without considering opponents.
+// The result is either SafetySafe or SafetyFatal.
+func (g *Game) classifyAction(action string) Safety {
+	cells, ok := g.moveCells(g.You, action)
+	if !ok {
+		return SafetyFatal
+	}
+	for _, c := range cells {
+		if g.Cells[c[1]][c[0]] != 0 {
+			return SafetyFatal
+		}
+	}
+	return SafetySafe
+}
+
+// classifyActions classifies all actions of the own player.
+// An action is possibly fatal if any active opponent can write into one of the cells of the action in the next step.
+func (g *Game) classifyActions() map[string]Safety {
+	actions := []string{ActionTurnLeft, ActionTurnRight, ActionSlower, ActionFaster, ActionNOOP}
+
+	reachable := make(map[[2]int]bool)
+	for i := range g.Players {
+		if i == g.You || !g.Players[i].Active {
+			continue
+		}
+		for _, a := range actions {
+			cells, _ := g.moveCells(i, a)
+			for _, c := range cells {
+				reachable[c] = true
+			}
+		}
+	}
+
+	result := make(map[string]Safety, len(actions))
+	for _, a := range actions {
+		result[a] = g.classifyAction(a)
+		if result[a] == SafetyFatal {
+			continue
+		}
+		cells, _ := g.moveCells(g.You, a)
+		for _, c := range cells {
+			if reachable[c] {
+				result[a] = SafetyPossiblyFatal
+				break
+			}
+		}
+	}
+	return result
+}
+
+// candidateActions returns all actions of the own player which are not certainly fatal.
+// If all actions are fatal, all valid actions are returned.
+func (g *Game) candidateActions() []string {
+	legal := g.legalActions()
+	candidates := make([]string, 0, len(legal))
+	for _, a := range legal {
+		if g.classifyAction(a) != SafetyFatal {
+			candidates = append(candidates, a)
+		}
+	}
+	if len(candidates) == 0 {
+		return legal
+	}
+	return candidates
+}
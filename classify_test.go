@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+// classifyTestGame returns a 10x10 board with the own player at (x,y). occupied cells belong to player 2, which is dead.
+func classifyTestGame(x, y int, direction string, speed, stepCounter int, occupied ...[2]int) *Game {
+	g := &Game{
+		Width:   10,
+		Height:  10,
+		Cells:   make([][]int8, 10),
+		You:     1,
+		Running: true,
+		Players: map[int]*Player{
+			1: {X: x, Y: y, Direction: direction, Speed: speed, Active: true, stepCounter: stepCounter},
+			2: {X: 0, Y: 0, Direction: DirectionUp, Speed: 1, Active: false, stepCounter: stepCounter},
+		},
+	}
+	for y := range g.Cells {
+		g.Cells[y] = make([]int8, g.Width)
+	}
+	g.Cells[y][x] = 1
+	for _, c := range occupied {
+		g.Cells[c[1]][c[0]] = 2
+	}
+	return g
+}
+
+func TestClassifyAction(t *testing.T) {
+	tests := []struct {
+		name   string
+		g      *Game
+		safety map[string]Safety
+	}{
+		{
+			name: "wall",
+			g:    classifyTestGame(0, 5, DirectionLeft, 1, 1),
+			safety: map[string]Safety{
+				ActionNOOP: SafetyFatal, ActionFaster: SafetyFatal, ActionSlower: SafetyFatal,
+				ActionTurnLeft: SafetySafe, ActionTurnRight: SafetySafe,
+			},
+		},
+		{
+			name: "trail",
+			g:    classifyTestGame(5, 5, DirectionUp, 1, 1, [2]int{5, 3}, [2]int{6, 5}),
+			safety: map[string]Safety{
+				ActionNOOP: SafetySafe, ActionFaster: SafetyFatal,
+				ActionTurnLeft: SafetySafe, ActionTurnRight: SafetyFatal,
+			},
+		},
+		{
+			name: "jump over trail",
+			g:    classifyTestGame(2, 5, DirectionRight, 3, 5, [2]int{4, 5}),
+			safety: map[string]Safety{
+				ActionNOOP: SafetySafe, ActionFaster: SafetySafe, ActionSlower: SafetyFatal,
+				ActionTurnLeft: SafetySafe, ActionTurnRight: SafetySafe,
+			},
+		},
+		{
+			name: "no jump between holes",
+			g:    classifyTestGame(2, 5, DirectionRight, 3, 4, [2]int{4, 5}),
+			safety: map[string]Safety{
+				ActionNOOP: SafetyFatal, ActionFaster: SafetyFatal, ActionSlower: SafetyFatal,
+				ActionTurnLeft: SafetySafe, ActionTurnRight: SafetySafe,
+			},
+		},
+		{
+			name: "jump out of the board",
+			g:    classifyTestGame(7, 5, DirectionRight, 3, 5),
+			safety: map[string]Safety{
+				ActionNOOP: SafetyFatal, ActionSlower: SafetySafe,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for a, want := range tt.safety {
+				got := tt.g.classifyAction(a)
+				if got != want {
+					t.Errorf("%s: %s, want %s", a, got, want)
+				}
+
+				// The classification must match the game
+				ng := tt.g.PublicCopy()
+				ng.playerAnswer = []string{a, ""}
+				ng.processRound()
+				if died := !ng.Players[1].Active; died != (got == SafetyFatal) {
+					t.Errorf("%s: classified as %s, but died is %t", a, got, died)
+				}
+			}
+		})
+	}
+}
+
+func TestClassifyActions(t *testing.T) {
+	// Player 2 at (3,4) moving right can reach (4,4) and (5,4)
+	g := classifyTestGame(5, 5, DirectionUp, 1, 1)
+	g.Players[2] = &Player{X: 3, Y: 4, Direction: DirectionRight, Speed: 1, Active: true, stepCounter: 1}
+	g.Cells[4][3] = 2
+
+	want := map[string]Safety{
+		ActionNOOP:      SafetyPossiblyFatal,
+		ActionFaster:    SafetyPossiblyFatal,
+		ActionSlower:    SafetyFatal,
+		ActionTurnLeft:  SafetySafe,
+		ActionTurnRight: SafetySafe,
+	}
+	got := g.classifyActions()
+	for a := range want {
+		if got[a] != want[a] {
+			t.Errorf("%s: %s, want %s", a, got[a], want[a])
+		}
+	}
+
+	// Dead opponents do not move
+	g.Players[2].Active = false
+	got = g.classifyActions()
+	for _, a := range []string{ActionNOOP, ActionFaster} {
+		if got[a] != SafetySafe {
+			t.Errorf("dead opponent: %s: %s, want %s", a, got[a], SafetySafe)
+		}
+	}
+}
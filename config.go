@@ -0,0 +1,490 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// configEnvPrefix is the prefix of environment variables overriding flags, e.g. SL_OW_MAX overrides -max.
+	configEnvPrefix = "SL_OW_"
+	// configEnvFile is the environment variable holding the config file if -config is not set.
+	configEnvFile = "SL_OW_CONFIG"
+)
+
+// Config holds all settings of sl_ow.
+//
+// It can be loaded from a JSON file (see -config). The keys are given by the json tags below,
+// missing keys keep their default value. 'sl_ow config dump' prints the effective configuration.
+//
+// Settings are applied in the following order, later ones override earlier ones:
+// defaults, config file, environment variables (SL_OW_ followed by the flag name in upper case with '-' replaced by '_'),
+// command line flags and finally the environment variables URL and KEY.
+type Config struct {
+	// Endpoint is the websocket API endpoint. Flag: -api, environment: URL.
+	Endpoint string `json:"endpoint"`
+	// Key is the API key. It is not part of dumps and the config hash. Flag: -key, environment: KEY.
+	Key string `json:"key,omitempty"`
+	// Sessions holds API keys. If not empty, one game per key is played concurrently instead of a single game with Key. Flag: -sessions.
+	Sessions []string `json:"sessions,omitempty"`
+	// MaxDuration limits the computation time per round. 0 disables the limit. Flag: -max.
+	MaxDuration Duration `json:"maxDuration"`
+	// Profile writes a CPU profile to this file if not empty. Flag: -profile.
+	Profile string `json:"profile"`
+
+	Engine     EngineConfig `json:"engine"`
+	Parameters Parameters   `json:"parameters"`
+	UI         UIConfig     `json:"ui"`
+}
+
+// EngineConfig holds the settings of the simulation engine.
+type EngineConfig struct {
+	// Workers is the number of local simulation workers. 0 uses one worker per CPU. Flag: -workers.
+	Workers int `json:"workers"`
+	// WorkerMargin is the time before the deadline at which the workers stop. Flag: -worker-margin.
+	WorkerMargin Duration `json:"workerMargin"`
+	// CollectMargin is the time before the deadline at which the results are evaluated. Must be smaller than WorkerMargin. Flag: -collect-margin.
+	CollectMargin Duration `json:"collectMargin"`
+	// Ponder enables simulating likely next states while waiting for the server. Flag: -ponder.
+	Ponder bool `json:"ponder"`
+	// Rollout is the name of the AI used in the simulations. Empty selects SuperRandomAI. Flag: -rollout.
+	Rollout string `json:"rollout"`
+	// Remote holds the addresses of remote workers (see 'sl_ow worker'). Flag: -remote (comma separated).
+	Remote []string `json:"remote"`
+	// Heatmap records where the simulated games passed and died for the terminal UI overlay. Flag: -heatmap.
+	Heatmap bool `json:"heatmap"`
+	// Profiles holds the profiles of opponents by name (see 'sl_ow profiles', which reads DefaultProfilesFile in the user configuration directory by default). They are updated after every game and used in the simulations. Empty disables the profiles. Flag: -profiles.
+	Profiles string `json:"profiles"`
+}
+
+// UIConfig holds the settings of the user interface and the outputs.
+type UIConfig struct {
+	// Mode selects the UI: "cmd", "terminal" or "quiet". Flags: -ui (terminal), -quiet (quiet), -mode.
+	Mode string `json:"mode"`
+	// Print writes the human readable output into this file if not empty. Flag: -print.
+	Print string `json:"print"`
+	// Dump writes all game data as gob into this file if not empty. Flag: -dump.
+	Dump string `json:"dump"`
+	// Record writes a move-by-move record of the game as JSON into this file if not empty (see 'sl_ow record'). Flag: -record.
+	Record string `json:"record"`
+	// PrintWin writes the outcome of the game as a simple "Win/Loss" into this file if not empty. Flag: -printwin.
+	PrintWin string `json:"printWin"`
+	// Play lets a human select the actions in the terminal UI, the engine only gives hints. Implies the terminal UI. Flag: -play.
+	Play bool `json:"play"`
+	// PlayDefault is the action sent if the human does not select an action in time. "engine" sends the action of the engine. Flag: -play-default.
+	PlayDefault string `json:"playDefault"`
+	// Log writes one JSON event per round into this file if not empty. "-" writes to stderr. Flag: -log.
+	Log string `json:"log"`
+	// History appends the result of every finished game to this file (see 'sl_ow stats', which reads DefaultHistoryFile in the user configuration directory by default). Empty disables the history. Flag: -history.
+	History string `json:"history"`
+}
+
+// DefaultConfig returns the configuration used if nothing else is configured.
+func DefaultConfig() Config {
+	return Config{
+		Endpoint:    "wss://msoll.de/spe_ed",
+		Key:         "KEY",
+		MaxDuration: 0,
+		Engine: EngineConfig{
+			Workers:       0,
+			WorkerMargin:  Duration(500 * time.Millisecond),
+			CollectMargin: Duration(250 * time.Millisecond),
+			Ponder:        true,
+		},
+		Parameters: DefaultParameters,
+		UI: UIConfig{
+			Mode:        "cmd",
+			PlayDefault: PlayDefaultEngine,
+		},
+	}
+}
+
+// Validate returns an error if the configuration is invalid.
+func (c Config) Validate() error {
+	if c.MaxDuration < 0 {
+		return fmt.Errorf("maxDuration must not be negative")
+	}
+	if c.Engine.Workers < 0 {
+		return fmt.Errorf("engine.workers must not be negative")
+	}
+	if c.Engine.CollectMargin < 0 || c.Engine.WorkerMargin <= c.Engine.CollectMargin {
+		return fmt.Errorf("engine.workerMargin (%s) must be larger than engine.collectMargin (%s)", c.Engine.WorkerMargin, c.Engine.CollectMargin)
+	}
+	if c.MaxDuration != 0 && c.MaxDuration <= c.Engine.WorkerMargin {
+		return fmt.Errorf("maxDuration must be larger than engine.workerMargin (is %s) or else simulations can not run", c.MaxDuration)
+	}
+	if c.Engine.Rollout != "" && NewAI(c.Engine.Rollout) == nil {
+		return fmt.Errorf("unknown engine.rollout %s (available: %s)", c.Engine.Rollout, strings.Join(AINames(), ", "))
+	}
+	switch c.UI.Mode {
+	case "cmd", "terminal", "quiet":
+	default:
+		return fmt.Errorf("unknown ui.mode %s (available: cmd, terminal, quiet)", c.UI.Mode)
+	}
+	if len(c.Sessions) > 0 && (c.UI.Mode == "terminal" || c.UI.Play) {
+		return fmt.Errorf("sessions can not be used with the terminal ui or play mode")
+	}
+	switch c.UI.PlayDefault {
+	case PlayDefaultEngine, ActionNOOP, ActionSlower, ActionFaster, ActionTurnLeft, ActionTurnRight:
+	default:
+		return fmt.Errorf("unknown ui.playDefault %s (available: engine, %s, %s, %s, %s, %s)", c.UI.PlayDefault, ActionNOOP, ActionSlower, ActionFaster, ActionTurnLeft, ActionTurnRight)
+	}
+	return c.Parameters.Validate()
+}
+
+// defaultUserFile returns the default location of a file in the user configuration directory.
+// If the directory is unknown, the file is placed in the working directory.
+func defaultUserFile(name string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "sl_ow_" + name
+	}
+	return filepath.Join(dir, "sl_ow", name)
+}
+
+// NumberWorker returns the number of local simulation workers.
+func (c Config) NumberWorker() int {
+	if c.Engine.Workers == 0 {
+		return runtime.NumCPU()
+	}
+	return c.Engine.Workers
+}
+
+// Public returns a copy of the configuration without secrets.
+func (c Config) Public() Config {
+	c.Key = ""
+	if len(c.Sessions) > 0 {
+		sessions := make([]string, len(c.Sessions))
+		for i := range sessions {
+			sessions[i] = "hidden"
+		}
+		c.Sessions = sessions
+	}
+	c.Engine.Remote = append([]string(nil), c.Engine.Remote...)
+	return c
+}
+
+// JSON returns the configuration without secrets as indented JSON.
+func (c Config) JSON() string {
+	b, err := json.MarshalIndent(c.Public(), "", "  ")
+	if err != nil {
+		// Config only contains simple types
+		panic(err)
+	}
+	return string(b)
+}
+
+// Hash returns a short hash identifying the settings which influence the play under the given rules:
+// the engine, the parameters and the rules. Outputs, keys and sessions are not part of the hash.
+func (c Config) Hash(rules Rules) string {
+	engine := c.Engine
+	engine.Heatmap = false
+	if engine.Profiles != "" {
+		// Only whether profiles are used matters, not where they are stored
+		engine.Profiles = "enabled"
+	}
+	b, err := json.Marshal(struct {
+		Engine     EngineConfig `json:"engine"`
+		Parameters Parameters   `json:"parameters"`
+		Rules      Rules        `json:"rules"`
+	}{engine, c.Parameters, rules})
+	if err != nil {
+		panic(err)
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:6])
+}
+
+// registerFlags registers all command line flags of the game client. The flags write directly into c.
+func (c *Config) registerFlags(fs *flag.FlagSet) {
+	fs.String("config", "", "Loads configuration from JSON file (see 'sl_ow config dump'). Environment: "+configEnvFile)
+	fs.StringVar(&c.Endpoint, "api", c.Endpoint, "API Endpoint")
+	fs.StringVar(&c.Key, "key", c.Key, "API key")
+	fs.Var((*listFlag)(&c.Sessions), "sessions", "Comma separated list of API keys, plays one game per key concurrently with shared workers (output goes to numbered files)")
+	fs.Var(&c.MaxDuration, "max", "Max computation time per round. 0 or empty string disables max time. Must be parseable as time.Duration")
+	fs.StringVar(&c.Profile, "profile", c.Profile, "Profile program to file")
+
+	fs.IntVar(&c.Engine.Workers, "workers", c.Engine.Workers, "Number of local simulation workers, 0 uses one per CPU")
+	fs.Var(&c.Engine.WorkerMargin, "worker-margin", "Time before the deadline at which the simulation workers stop")
+	fs.Var(&c.Engine.CollectMargin, "collect-margin", "Time before the deadline at which the action is selected")
+	fs.BoolVar(&c.Engine.Ponder, "ponder", c.Engine.Ponder, "Simulate likely next states while waiting for the server")
+	fs.StringVar(&c.Engine.Rollout, "rollout", c.Engine.Rollout, "AI used in the simulations (default SuperRandomAI)")
+	fs.Var((*listFlag)(&c.Engine.Remote), "remote", "Comma separated list of worker addresses (see 'sl_ow worker')")
+	fs.BoolVar(&c.Engine.Heatmap, "heatmap", c.Engine.Heatmap, "Record a heatmap of the simulations (see overlay in terminal ui)")
+	fs.StringVar(&c.Engine.Profiles, "profiles", c.Engine.Profiles, fmt.Sprintf("Opponent profiles file, e.g. %s (see 'sl_ow profiles'), empty disables the profiles", defaultUserFile(DefaultProfilesFile)))
+	fs.Var(&parametersFileFlag{p: &c.Parameters}, "params", "Loads decision and AI parameters from file (see 'sl_ow tune')")
+	fs.Var(&modelFileFlag{p: &c.Parameters}, "model", "Loads the model of LearnedAI from file (see 'sl_ow train')")
+
+	fs.StringVar(&c.UI.Mode, "mode", c.UI.Mode, "UI to use: cmd, terminal or quiet")
+	fs.Var(&modeFlag{mode: &c.UI.Mode, value: "quiet"}, "quiet", "Only print result")
+	fs.Var(&modeFlag{mode: &c.UI.Mode, value: "terminal"}, "ui", "Enables terminal ui")
+	fs.StringVar(&c.UI.Print, "print", c.UI.Print, "Prints output into file")
+	fs.StringVar(&c.UI.Dump, "dump", c.UI.Dump, "Dumps game data as gob to file")
+	fs.StringVar(&c.UI.Record, "record", c.UI.Record, "Writes a move-by-move record of the game as JSON to file (see 'sl_ow record')")
+	fs.StringVar(&c.UI.PrintWin, "printwin", c.UI.PrintWin, "Prints outcome of the game as a simple \"Win/Loss\" into file")
+	fs.BoolVar(&c.UI.Play, "play", c.UI.Play, "Play yourself in the terminal ui with hints of the engine")
+	fs.StringVar(&c.UI.PlayDefault, "play-default", c.UI.PlayDefault, "Action sent in play mode if no key is pressed in time, engine uses the action of the engine")
+	fs.StringVar(&c.UI.Log, "log", c.UI.Log, "Writes one JSON event per round into file, - for stderr")
+	fs.StringVar(&c.UI.History, "history", c.UI.History, fmt.Sprintf("Appends the result of every game to file, e.g. %s (see 'sl_ow stats'), empty disables the history", defaultUserFile(DefaultHistoryFile)))
+}
+
+// parseConfig parses the command line flags and returns the effective configuration.
+func parseConfig(name string, args []string) (Config, error) {
+	// First pass: find out which flags are set
+	scratch := DefaultConfig()
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	scratch.registerFlags(fs)
+	err := fs.Parse(args)
+	if err != nil {
+		return scratch, err
+	}
+	if fs.NArg() != 0 {
+		return scratch, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	c := DefaultConfig()
+
+	file := fs.Lookup("config").Value.String()
+	if file == "" {
+		file = os.Getenv(configEnvFile)
+	}
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return c, err
+		}
+		err = json.Unmarshal(b, &c)
+		if err != nil {
+			return c, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	final := flag.NewFlagSet(name, flag.ContinueOnError)
+	c.registerFlags(final)
+
+	// Environment
+	var envErr error
+	final.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || envErr != nil {
+			return
+		}
+		env := configEnvPrefix + strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))
+		v, ok := os.LookupEnv(env)
+		if !ok {
+			return
+		}
+		err := final.Set(f.Name, v)
+		if err != nil {
+			envErr = fmt.Errorf("%s: %w", env, err)
+		}
+	})
+	if envErr != nil {
+		return c, envErr
+	}
+
+	// Command line
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "config" || flagErr != nil {
+			return
+		}
+		err := final.Set(f.Name, f.Value.String())
+		if err != nil {
+			flagErr = fmt.Errorf("-%s: %w", f.Name, err)
+		}
+	})
+	if flagErr != nil {
+		return c, flagErr
+	}
+
+	// Legacy environment
+	env := os.Getenv("URL")
+	if env != "" {
+		log.Println("Using URL from env:", env)
+		c.Endpoint = env
+	}
+
+	env = os.Getenv("KEY")
+	if env != "" {
+		log.Println("Using KEY from env:", env)
+		c.Key = env
+	}
+
+	return c, c.Validate()
+}
+
+// configCommand handles configuration related tasks.
+func configCommand(args []string) {
+	if len(args) == 0 || args[0] != "dump" {
+		fmt.Fprintln(os.Stderr, "usage: sl_ow config dump [flags]")
+		fmt.Fprintln(os.Stderr, "Prints the effective configuration for the given flags, environment and config file.")
+		os.Exit(2)
+	}
+
+	c, err := parseConfig("config dump", args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	fmt.Println(c.JSON())
+	fmt.Fprintln(os.Stderr, "hash (default rules):", c.Hash(DefaultRules))
+}
+
+// Duration is a time.Duration which is represented as a string like "250ms" in JSON.
+type Duration time.Duration
+
+// String returns the duration in the format of time.Duration.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Set parses the duration. An empty string is parsed as 0.
+func (d *Duration) Set(s string) error {
+	if s == "" {
+		*d = 0
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON encodes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes the duration from a string or a number of nanoseconds.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err == nil {
+		return d.Set(s)
+	}
+	var n int64
+	err = json.Unmarshal(b, &n)
+	if err != nil {
+		return fmt.Errorf("duration must be a string like \"250ms\" or a number of nanoseconds")
+	}
+	*d = Duration(n)
+	return nil
+}
+
+// listFlag is a comma separated list of strings.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = nil
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e != "" {
+			*l = append(*l, e)
+		}
+	}
+	return nil
+}
+
+// modeFlag is a boolean flag which selects a UI mode.
+type modeFlag struct {
+	mode  *string
+	value string
+}
+
+func (m *modeFlag) String() string {
+	if m.mode == nil {
+		return "false"
+	}
+	return strconv.FormatBool(*m.mode == m.value)
+}
+
+func (m *modeFlag) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	if b {
+		*m.mode = m.value
+	}
+	return nil
+}
+
+func (m *modeFlag) IsBoolFlag() bool {
+	return true
+}
+
+// parametersFileFlag loads parameters from a file.
+type parametersFileFlag struct {
+	p    *Parameters
+	file string
+}
+
+func (pf *parametersFileFlag) String() string {
+	return pf.file
+}
+
+func (pf *parametersFileFlag) Set(s string) error {
+	p, err := loadParameters(s)
+	if err != nil {
+		return err
+	}
+	pf.file = s
+	if p.LearnedModel == nil {
+		// Keep a model loaded with -model
+		p.LearnedModel = pf.p.LearnedModel
+	}
+	*pf.p = p
+	return nil
+}
+
+// modelFileFlag loads the model of LearnedAI from a file.
+type modelFileFlag struct {
+	p    *Parameters
+	file string
+}
+
+func (mf *modelFileFlag) String() string {
+	return mf.file
+}
+
+func (mf *modelFileFlag) Set(s string) error {
+	m, err := loadLearnedModel(s)
+	if err != nil {
+		return err
+	}
+	mf.file = s
+	mf.p.LearnedModel = m
+	return nil
+}
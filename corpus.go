@@ -0,0 +1,367 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CorpusDirectory is the default directory of the position corpus.
+const CorpusDirectory = "corpus"
+
+// CorpusPosition is a position of the regression corpus together with the expected actions.
+// The position is either given as a full game (Game) or as a board in the style of PrintGame (Board, Players, You, Rules).
+type CorpusPosition struct {
+	Name          string          `json:"name,omitempty"` // Defaults to the file name
+	Description   string          `json:"description,omitempty"`
+	Round         int             `json:"round"` // Needed to know where holes are created
+	Game          *Game           `json:"game,omitempty"`
+	Board         []string        `json:"board,omitempty"`
+	Players       map[int]*Player `json:"players,omitempty"`
+	You           int             `json:"you,omitempty"`
+	Rules         *Rules          `json:"rules,omitempty"` // Only used with board, DefaultRules if nil
+	Accept        []string        `json:"accept"`
+	MinConfidence float64         `json:"minConfidence,omitempty"` // Minimal win chance of the selected action
+}
+
+// CorpusResult is the result of the engine on a corpus position.
+type CorpusResult struct {
+	Position   CorpusPosition
+	Action     string
+	Reason     string
+	Confidence float64
+	Pass       bool
+	Message    string
+}
+
+// parseBoard converts a board in the style of PrintGame into cells.
+// Empty cells can be written as '·' or '.', holes as '×' or 'x', players as returned by playerRune. Player heads (arrows) are assigned to the player at this position.
+func parseBoard(board []string, players map[int]*Player, you int) ([][]int8, error) {
+	if len(board) == 0 {
+		return nil, errors.New("empty board")
+	}
+	cells := make([][]int8, len(board))
+	width := -1
+	for y := range board {
+		row := []rune(board[y])
+		if width == -1 {
+			width = len(row)
+		}
+		if len(row) != width {
+			return nil, fmt.Errorf("row %d has width %d, expected %d", y, len(row), width)
+		}
+		cells[y] = make([]int8, width)
+		for x, r := range row {
+			switch {
+			case r == '·' || r == '.':
+				cells[y][x] = 0
+			case r == '×' || r == 'x':
+				cells[y][x] = -1
+			case r == '●':
+				cells[y][x] = int8(you)
+			case playerFromRune(r) != 0:
+				cells[y][x] = int8(playerFromRune(r))
+			case strings.ContainsRune("⮝⮞⮟⮜⮉⮊⮋⮈", r):
+				id := 0
+				for k, p := range players {
+					if p.X == x && p.Y == y {
+						id = k
+					}
+				}
+				if id == 0 {
+					return nil, fmt.Errorf("head at (%d, %d) without player", x, y)
+				}
+				cells[y][x] = int8(id)
+			default:
+				return nil, fmt.Errorf("unknown cell %q at (%d, %d)", r, x, y)
+			}
+		}
+	}
+	return cells, nil
+}
+
+// game returns the game of the position.
+func (c CorpusPosition) game() (*Game, error) {
+	var g *Game
+	switch {
+	case c.Game != nil && c.Board != nil:
+		return nil, errors.New("position must contain either game or board")
+	case c.Game != nil:
+		g = c.Game.PublicCopy()
+	case c.Board != nil:
+		cells, err := parseBoard(c.Board, c.Players, c.You)
+		if err != nil {
+			return nil, err
+		}
+		g = &Game{
+			Width:   len(cells[0]),
+			Height:  len(cells),
+			Cells:   cells,
+			Players: make(map[int]*Player, len(c.Players)),
+			You:     c.You,
+			Running: true,
+			Rules:   c.Rules,
+		}
+		for k, p := range c.Players {
+			player := *p
+			g.Players[k] = &player
+		}
+	default:
+		return nil, errors.New("position contains no game")
+	}
+
+	p, ok := g.Players[g.You]
+	if !ok || !p.Active {
+		return nil, fmt.Errorf("player %d is not an active player", g.You)
+	}
+	for k, p := range g.Players {
+		if !p.Active {
+			continue
+		}
+		if p.X < 0 || p.X >= g.Width || p.Y < 0 || p.Y >= g.Height || int(g.Cells[p.Y][p.X]) != k {
+			return nil, fmt.Errorf("player %d is not on its own cell", k)
+		}
+		g.Players[k].stepCounter = c.Round - 1
+	}
+	g.PopulateInternalCellsFlat()
+	return g, nil
+}
+
+// validate checks the position for errors.
+func (c CorpusPosition) validate() error {
+	if c.Round < 1 {
+		return errors.New("round must be at least 1")
+	}
+	if len(c.Accept) == 0 {
+		return errors.New("no accepted actions")
+	}
+	for _, a := range c.Accept {
+		if !IsValidAction(a) {
+			return fmt.Errorf("unknown action %s", a)
+		}
+	}
+	if c.MinConfidence < 0 || c.MinConfidence > 1 {
+		return errors.New("minConfidence must be between 0 and 1")
+	}
+	_, err := c.game()
+	return err
+}
+
+// loadCorpus loads all positions (*.json) of a directory sorted by name.
+func loadCorpus(dir string) ([]CorpusPosition, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	positions := make([]CorpusPosition, 0, len(files))
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var c CorpusPosition
+		err = json.Unmarshal(b, &c)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if c.Name == "" {
+			c.Name = strings.TrimSuffix(filepath.Base(file), ".json")
+		}
+		err = c.validate()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		positions = append(positions, c)
+	}
+	return positions, nil
+}
+
+// evaluatePosition runs the engine on a position and checks the decision.
+func evaluatePosition(engine *Engine, c CorpusPosition, budget time.Duration) CorpusResult {
+	result := CorpusResult{Position: c}
+	g, err := c.game()
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	data := analyzeDecision(engine, GameData{Game: g, Round: c.Round}, budget)
+	result.Action = data.Action
+	result.Reason = data.Reason
+	result.Confidence = data.Collect[data.Action].WinChance()
+	if data.Endgame != nil {
+		// No simulations, use the value of the endgame search scaled to [0, 1]
+		result.Confidence = (data.Endgame.Value + 1) / 2
+	}
+
+	accepted := false
+	for _, a := range c.Accept {
+		if a == data.Action {
+			accepted = true
+		}
+	}
+	switch {
+	case !accepted:
+		result.Message = fmt.Sprintf("%s not in accepted actions %s", data.Action, strings.Join(c.Accept, ","))
+	case result.Confidence < c.MinConfidence:
+		result.Message = fmt.Sprintf("win chance %.2f below %.2f", result.Confidence, c.MinConfidence)
+	default:
+		result.Pass = true
+	}
+	return result
+}
+
+// corpusCommand runs the engine on the corpus or exports positions from a dump into the corpus.
+func corpusCommand(args []string) {
+	if len(args) > 0 && args[0] == "export" {
+		corpusExportCommand(args[1:])
+		return
+	}
+
+	fs := flag.NewFlagSet("corpus", flag.ExitOnError)
+	budget := fs.Duration("budget", 10*time.Second, "Maximal computation time of the engine per position")
+	runs := fs.Int("runs", 1000, "Number of simulations per position")
+	seed := fs.Int64("seed", 1, "Seed of the simulations, 0 for a random seed")
+	rollout := fs.String("rollout", "", "AI used in the simulations (default SuperRandomAI)")
+	paramsFile := fs.String("params", "", "Loads decision and AI parameters from file")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: sl_ow corpus [flags] [directory]")
+		fmt.Fprintln(fs.Output(), "       sl_ow corpus export [flags] dump round file")
+		fmt.Fprintf(fs.Output(), "Runs the engine on all positions of the corpus (default %s) with a single worker and reports which positions fail.\n", CorpusDirectory)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	dir := CorpusDirectory
+	if fs.NArg() == 1 {
+		dir = fs.Arg(0)
+	}
+	if *budget <= 0 || *runs < 0 {
+		log.Fatalln("budget must be positive and runs not negative")
+	}
+	if *rollout != "" && NewAI(*rollout) == nil {
+		log.Fatalln("unknown rollout ai", *rollout)
+	}
+
+	parameters := DefaultParameters
+	if *paramsFile != "" {
+		var err error
+		parameters, err = loadParameters(*paramsFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	positions, err := loadCorpus(dir)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	engine := &Engine{Workers: 1, Rollout: *rollout, Parameters: &parameters, MaxRuns: *runs, Seed: *seed}
+	failed := 0
+	for _, c := range positions {
+		r := evaluatePosition(engine, c, *budget)
+		if r.Pass {
+			fmt.Printf("PASS %s: %s (%s, win chance %.2f)\n", c.Name, r.Action, r.Reason, r.Confidence)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL %s: %s\n", c.Name, r.Message)
+	}
+	fmt.Printf("%d positions, %d failed\n", len(positions), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// corpusExportCommand writes a round of a dump as a corpus position.
+func corpusExportCommand(args []string) {
+	fs := flag.NewFlagSet("corpus export", flag.ExitOnError)
+	accept := listFlag{}
+	fs.Var(&accept, "accept", "Comma separated list of accepted actions (default the recorded action)")
+	minConfidence := fs.Float64("min-confidence", 0, "Minimal win chance of the selected action")
+	description := fs.String("description", "", "Description of the position")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: sl_ow corpus export [flags] dump round file")
+		fmt.Fprintln(fs.Output(), "Exports a round of a dump (see -dump) as a corpus position in board format.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 3 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var round int
+	_, err := fmt.Sscan(fs.Arg(1), &round)
+	if err != nil {
+		log.Fatalln("invalid round:", err)
+	}
+
+	states, err := loadDump(fs.Arg(0))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var recorded *GameData
+	for i := range states {
+		if states[i].Round == round && states[i].Game != nil {
+			recorded = &states[i]
+		}
+	}
+	if recorded == nil {
+		log.Fatalln("round", round, "not found in dump")
+	}
+
+	c := CorpusPosition{
+		Name:          strings.TrimSuffix(filepath.Base(fs.Arg(2)), ".json"),
+		Description:   *description,
+		Round:         round,
+		Board:         strings.Split(recorded.Game.PrintGame(false), "\n"),
+		Players:       recorded.Game.PublicCopy().Players,
+		You:           recorded.Game.You,
+		Rules:         recorded.Game.Rules,
+		Accept:        []string(accept),
+		MinConfidence: *minConfidence,
+	}
+	if len(c.Accept) == 0 {
+		c.Accept = []string{recorded.Action}
+	}
+	err = c.validate()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = ioutil.WriteFile(fs.Arg(2), append(b, '\n'), 0644)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
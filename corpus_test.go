@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCorpus(t *testing.T) {
+	positions, err := loadCorpus(CorpusDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) == 0 {
+		t.Fatal("corpus is empty")
+	}
+
+	runs := 1000
+	if testing.Short() {
+		runs = 200
+	}
+	engine := &Engine{Workers: 1, Parameters: &DefaultParameters, MaxRuns: runs, Seed: 1}
+	for _, c := range positions {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			r := evaluatePosition(engine, c, 10*time.Second)
+			if !r.Pass {
+				t.Errorf("%s (selected %s: %s)", r.Message, r.Action, r.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// endgameDraw is the value of both players dying in the same round. It is no win, but better than losing alone.
+	endgameDraw = -0.5
+	// endgameTerritoryScale scales the territory evaluation so that it stays below certain outcomes.
+	endgameTerritoryScale = 0.9
+	// endgameIterations is the number of regret matching iterations per matrix game.
+	endgameIterations = 300
+	// endgameMinProbability is the probability below which actions of the mixed strategy are not played.
+	endgameMinProbability = 0.05
+)
+
+// EndgameData holds the result of the two player endgame search.
+type EndgameData struct {
+	Opponent int
+	Depth    int                // Depth of the last completed search in rounds
+	Value    float64            // Guaranteed value of Strategy in [-1, 1], 1 is a certain win
+	Strategy map[string]float64 // Mixed strategy of the own player
+}
+
+// activeOpponent returns the only active opponent if exactly the own player and one opponent are active.
+func (g *Game) activeOpponent() (int, bool) {
+	if !g.Players[g.You].Active {
+		return 0, false
+	}
+	opponent := 0
+	for k, p := range g.Players {
+		if k == g.You || !p.Active {
+			continue
+		}
+		if opponent != 0 {
+			return 0, false
+		}
+		opponent = k
+	}
+	return opponent, opponent != 0
+}
+
+// endgameSearch searches the joint actions of the own player and one opponent.
+// Since both players move simultaneously, every node is a zero-sum matrix game which is solved by regret matching.
+type endgameSearch struct {
+	ctx      context.Context
+	engine   *Engine
+	you      int
+	opponent int
+}
+
+// outcome returns the value of g if the game is decided.
+func (s *endgameSearch) outcome(g *Game) (float64, bool) {
+	you, opponent := g.Players[s.you].Active, g.Players[s.opponent].Active
+	switch {
+	case you && opponent:
+		return 0, false
+	case you:
+		return 1, true
+	case opponent:
+		return -1, true
+	default:
+		return endgameDraw, true
+	}
+}
+
+// evaluate returns the relative territory of the own player scaled to [-endgameTerritoryScale, endgameTerritoryScale].
+func (s *endgameSearch) evaluate(g *Game) float64 {
+	t := g.territory()
+	you, opponent := float64(t[s.you]), float64(t[s.opponent])
+	if you+opponent <= 0 {
+		return 0
+	}
+	return endgameTerritoryScale * (you - opponent) / (you + opponent)
+}
+
+// actions returns the legal actions of player i.
+func (s *endgameSearch) actions(g *Game, i int) []string {
+	you := g.You
+	g.You = i
+	actions := g.legalActions()
+	g.You = you
+	return actions
+}
+
+// matrix returns the payoff matrix of all joint actions in g searched depth rounds deep.
+// ok is false if the search was cancelled.
+func (s *endgameSearch) matrix(g *Game, depth int, yours, theirs []string) ([][]float64, bool) {
+	m := make([][]float64, len(yours))
+	for i := range yours {
+		m[i] = make([]float64, len(theirs))
+		for j := range theirs {
+			var ok bool
+			m[i][j], ok = s.value(g, depth, yours[i], theirs[j])
+			if !ok {
+				return nil, false
+			}
+		}
+	}
+	return m, true
+}
+
+// value returns the value after the joint action searched depth rounds deep.
+// ok is false if the search was cancelled.
+func (s *endgameSearch) value(g *Game, depth int, yours, theirs string) (float64, bool) {
+	if s.ctx.Err() != nil {
+		return 0, false
+	}
+	next, _ := g.applyActions(map[int]string{s.you: yours, s.opponent: theirs})
+	if v, ok := s.outcome(next); ok {
+		return v, true
+	}
+	if depth <= 1 {
+		return s.evaluate(next), true
+	}
+	m, ok := s.matrix(next, depth-1, s.actions(next, s.you), s.actions(next, s.opponent))
+	if !ok {
+		return 0, false
+	}
+	_, v := solveMatrixGame(m, endgameIterations)
+	return v, true
+}
+
+// root returns the payoff matrix of g searched depth rounds deep.
+// The rows are searched in parallel on the workers of the engine (see Engine.run).
+func (s *endgameSearch) root(g *Game, depth int, yours, theirs []string) ([][]float64, bool) {
+	m := make([][]float64, len(yours))
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	var l sync.Mutex
+	next, remaining := 0, len(yours)
+	step := func(int) {
+		l.Lock()
+		i := next
+		next++
+		l.Unlock()
+		if i >= len(yours) {
+			// All rows are taken, wait for the others
+			<-ctx.Done()
+			return
+		}
+
+		row, ok := s.matrix(g.PublicCopy(), depth, yours[i:i+1], theirs)
+		if !ok {
+			return
+		}
+		l.Lock()
+		defer l.Unlock()
+		m[i] = row[0]
+		remaining--
+		if remaining == 0 {
+			cancel()
+		}
+	}
+	<-s.engine.run(ctx, step)
+	return m, remaining == 0
+}
+
+// solveMatrixGame approximates an equilibrium of the zero-sum game with payoff matrix m, in which the row player maximises.
+// It returns the mixed strategy of the row player and the value it guarantees against every column.
+// If the game has a saddle point in pure strategies, it is returned directly.
+func solveMatrixGame(m [][]float64, iterations int) ([]float64, float64) {
+	rows, cols := len(m), len(m[0])
+
+	// Saddle point: maximin equals minimax
+	maximin, best := math.Inf(-1), 0
+	for i := range m {
+		worst := math.Inf(1)
+		for j := range m[i] {
+			worst = math.Min(worst, m[i][j])
+		}
+		if worst > maximin {
+			maximin, best = worst, i
+		}
+	}
+	minimax := math.Inf(1)
+	for j := 0; j < cols; j++ {
+		most := math.Inf(-1)
+		for i := range m {
+			most = math.Max(most, m[i][j])
+		}
+		minimax = math.Min(minimax, most)
+	}
+	if maximin >= minimax {
+		strategy := make([]float64, rows)
+		strategy[best] = 1
+		return strategy, maximin
+	}
+
+	// Regret matching+ for both players
+	rowRegret, colRegret := make([]float64, rows), make([]float64, cols)
+	rowSum := make([]float64, rows)
+	x, y := make([]float64, rows), make([]float64, cols)
+	rowValue, colValue := make([]float64, rows), make([]float64, cols)
+	for it := 0; it < iterations; it++ {
+		regretStrategy(rowRegret, x)
+		regretStrategy(colRegret, y)
+		v := 0.0
+		for i := range m {
+			rowValue[i] = 0
+			for j := range m[i] {
+				rowValue[i] += y[j] * m[i][j]
+			}
+			v += x[i] * rowValue[i]
+		}
+		for j := 0; j < cols; j++ {
+			colValue[j] = 0
+			for i := range m {
+				colValue[j] += x[i] * m[i][j]
+			}
+		}
+		for i := range rowRegret {
+			rowRegret[i] = math.Max(0, rowRegret[i]+rowValue[i]-v)
+			rowSum[i] += x[i]
+		}
+		for j := range colRegret {
+			colRegret[j] = math.Max(0, colRegret[j]+v-colValue[j])
+		}
+	}
+
+	total := 0.0
+	for i := range rowSum {
+		total += rowSum[i]
+	}
+	value := math.Inf(1)
+	for i := range rowSum {
+		x[i] = rowSum[i] / total
+	}
+	for j := 0; j < cols; j++ {
+		v := 0.0
+		for i := range m {
+			v += x[i] * m[i][j]
+		}
+		value = math.Min(value, v)
+	}
+	if value < maximin {
+		// The pure maximin strategy guarantees more than the approximation
+		strategy := make([]float64, rows)
+		strategy[best] = 1
+		return strategy, maximin
+	}
+	return x, value
+}
+
+// regretStrategy writes the strategy proportional to the positive regrets into s. Without positive regret, s is uniform.
+func regretStrategy(regret, s []float64) {
+	total := 0.0
+	for i := range regret {
+		total += regret[i]
+	}
+	for i := range s {
+		if total > 0 {
+			s[i] = regret[i] / total
+		} else {
+			s[i] = 1 / float64(len(s))
+		}
+	}
+}
+
+// endgame searches the joint actions if only the own player and one opponent are left (see Parameters.EndgameDepth).
+// The search deepens iteratively until the maximal depth is reached or ctx is done.
+// If a search completed and the position is not lost, the action is sampled from the mixed strategy and set in data together with the reason.
+// It returns whether an action was set.
+func (e *Engine) endgame(ctx context.Context, g *Game, data *GameData) bool {
+	maxDepth := e.params().EndgameDepth
+	if maxDepth <= 0 {
+		return false
+	}
+	opponent, ok := g.activeOpponent()
+	if !ok {
+		return false
+	}
+
+	s := &endgameSearch{ctx: ctx, engine: e, you: g.You, opponent: opponent}
+	yours, theirs := s.actions(g, g.You), s.actions(g, opponent)
+	var result *EndgameData
+	for depth := 1; depth <= maxDepth; depth++ {
+		m, ok := s.root(g, depth, yours, theirs)
+		if !ok {
+			break
+		}
+		strategy, value := solveMatrixGame(m, endgameIterations)
+		result = &EndgameData{Opponent: opponent, Depth: depth, Value: value, Strategy: make(map[string]float64, len(yours))}
+		for i := range yours {
+			result.Strategy[yours[i]] = strategy[i]
+		}
+		if value == 1 || value == -1 {
+			// Decided, deeper search can not change the outcome
+			break
+		}
+	}
+	if result == nil || result.Value <= endgameDraw {
+		// Lost positions are left to the simulations, which prefer actions surviving longer
+		return false
+	}
+
+	total := 0.0
+	for _, p := range result.Strategy {
+		if p >= endgameMinProbability {
+			total += p
+		}
+	}
+	r := e.workerRandom(data.Round, randomEndgame).Float64() * total
+	played := make([]string, 0, len(result.Strategy))
+	for _, a := range yours {
+		p := result.Strategy[a]
+		if p < endgameMinProbability {
+			continue
+		}
+		played = append(played, fmt.Sprintf("%s %.2f", a, p))
+		if r >= 0 {
+			data.Action = a
+		}
+		r -= p
+	}
+	sort.Strings(played)
+	data.Endgame = result
+	data.Reason = fmt.Sprintf("endgame (depth %d, value %.2f: %s)", result.Depth, result.Value, strings.Join(played, ", "))
+	return true
+}
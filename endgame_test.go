@@ -0,0 +1,209 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+// endgameTestGame returns a 5x5 board with two players. The player at (0,0) is trapped in the corner and dies in the next round,
+// the player at (3,3) can move freely. If trapped is 0, no player is trapped.
+func endgameTestGame(you, trapped int) *Game {
+	g := &Game{
+		Width:   5,
+		Height:  5,
+		Cells:   make([][]int8, 5),
+		You:     you,
+		Running: true,
+		Players: map[int]*Player{
+			1: {X: 0, Y: 0, Direction: DirectionUp, Speed: 1, Active: true, stepCounter: 1},
+			2: {X: 3, Y: 3, Direction: DirectionUp, Speed: 1, Active: true, stepCounter: 1},
+		},
+	}
+	for y := range g.Cells {
+		g.Cells[y] = make([]int8, g.Width)
+	}
+	g.Cells[0][0] = 1
+	g.Cells[3][3] = 2
+	if trapped != 0 {
+		g.Cells[0][1] = 2
+		g.Cells[1][0] = 2
+	} else {
+		g.Players[1].X, g.Players[1].Y, g.Players[1].Direction = 1, 1, DirectionDown
+		g.Cells[0][0] = 0
+		g.Cells[1][1] = 1
+	}
+	return g
+}
+
+func TestEndgame(t *testing.T) {
+	pool := NewWorkerPool(2)
+	defer pool.Close()
+	engines := map[string]*Engine{
+		"workers": {Workers: 2, Seed: 1},
+		"pool":    {Pool: pool, Seed: 1},
+	}
+	for name, e := range engines {
+		t.Run(name, func(t *testing.T) {
+			// Won: the opponent is trapped
+			g := endgameTestGame(2, 1)
+			data := newGameData(g, 2)
+			if !e.endgame(context.Background(), g, &data) {
+				t.Fatal("won position: no action")
+			}
+			if data.Endgame == nil || data.Endgame.Value != 1 || data.Endgame.Opponent != 1 {
+				t.Fatalf("won position: endgame %+v", data.Endgame)
+			}
+			if data.Endgame.Strategy[data.Action] < endgameMinProbability {
+				t.Errorf("won position: action %s is not part of the strategy %v", data.Action, data.Endgame.Strategy)
+			}
+			next, _ := g.applyActions(map[int]string{1: ActionNOOP, 2: data.Action})
+			if !next.Players[2].Active || next.Players[1].Active {
+				t.Errorf("won position: action %s does not win", data.Action)
+			}
+
+			// Lost: the own player is trapped
+			g = endgameTestGame(1, 1)
+			data = newGameData(g, 2)
+			if e.endgame(context.Background(), g, &data) {
+				t.Errorf("lost position: action %s set (%s)", data.Action, data.Reason)
+			}
+			if data.Endgame != nil || data.Action != "nothing" {
+				t.Errorf("lost position: endgame %+v, action %s", data.Endgame, data.Action)
+			}
+
+			// Cancelled: no completed search
+			g = endgameTestGame(1, 0)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			data = newGameData(g, 2)
+			if e.endgame(ctx, g, &data) || data.Endgame != nil {
+				t.Errorf("cancelled search: action %s set, endgame %+v", data.Action, data.Endgame)
+			}
+			s := &endgameSearch{ctx: ctx, engine: e, you: 1, opponent: 2}
+			if _, ok := s.root(g, 1, s.actions(g, 1), s.actions(g, 2)); ok {
+				t.Error("cancelled search: matrix returned")
+			}
+
+			// Not decided: the search completes without a certain outcome
+			s = &endgameSearch{ctx: context.Background(), engine: e, you: 1, opponent: 2}
+			yours, theirs := s.actions(g, 1), s.actions(g, 2)
+			m, ok := s.root(g, 2, yours, theirs)
+			if !ok {
+				t.Fatal("search not completed")
+			}
+			for i := range m {
+				if len(m[i]) != len(theirs) {
+					t.Fatalf("row %d has %d values, want %d", i, len(m[i]), len(theirs))
+				}
+			}
+		})
+	}
+}
+
+func TestSolveMatrixGame(t *testing.T) {
+	tests := []struct {
+		name     string
+		m        [][]float64
+		strategy []float64
+		value    float64
+	}{
+		{
+			name:     "saddle point",
+			m:        [][]float64{{3, 1, 4}, {2, 2, 3}, {0, 1, 5}},
+			strategy: []float64{0, 1, 0},
+			value:    2,
+		},
+		{
+			name:     "matching pennies",
+			m:        [][]float64{{1, -1}, {-1, 1}},
+			strategy: []float64{0.5, 0.5},
+			value:    0,
+		},
+		{
+			name:     "dominated row",
+			m:        [][]float64{{1, -1}, {-1, 1}, {-1, -1}},
+			strategy: []float64{0.5, 0.5, 0},
+			value:    0,
+		},
+		{
+			name:     "single action",
+			m:        [][]float64{{-1, 0.5}},
+			strategy: []float64{1},
+			value:    -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, value := solveMatrixGame(tt.m, endgameIterations)
+			if math.Abs(value-tt.value) > 0.05 {
+				t.Errorf("value is %f, want %f", value, tt.value)
+			}
+			sum := 0.0
+			for i := range strategy {
+				sum += strategy[i]
+				if math.Abs(strategy[i]-tt.strategy[i]) > 0.05 {
+					t.Errorf("strategy is %v, want %v", strategy, tt.strategy)
+					break
+				}
+			}
+			if math.Abs(sum-1) > 1e-9 {
+				t.Errorf("strategy %v sums to %f", strategy, sum)
+			}
+
+			// The value must be guaranteed against every column
+			for j := range tt.m[0] {
+				v := 0.0
+				for i := range tt.m {
+					v += strategy[i] * tt.m[i][j]
+				}
+				if v < value-1e-9 {
+					t.Errorf("column %d yields %f, less than the value %f", j, v, value)
+				}
+			}
+		})
+	}
+}
+
+func TestActiveOpponent(t *testing.T) {
+	tests := []struct {
+		name     string
+		active   map[int]bool
+		you      int
+		opponent int
+		ok       bool
+	}{
+		{"one opponent", map[int]bool{1: true, 2: true}, 1, 2, true},
+		{"one of several opponents left", map[int]bool{1: false, 2: true, 3: true, 4: false}, 3, 2, true},
+		{"two opponents", map[int]bool{1: true, 2: true, 3: true}, 1, 0, false},
+		{"no opponent", map[int]bool{1: true, 2: false}, 1, 0, false},
+		{"own player dead", map[int]bool{1: false, 2: true}, 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Game{You: tt.you, Players: make(map[int]*Player)}
+			for k, active := range tt.active {
+				g.Players[k] = &Player{Active: active}
+			}
+			opponent, ok := g.activeOpponent()
+			if opponent != tt.opponent || ok != tt.ok {
+				t.Errorf("activeOpponent() = %d, %t, want %d, %t", opponent, ok, tt.opponent, tt.ok)
+			}
+		})
+	}
+}
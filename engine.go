@@ -0,0 +1,456 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ActionData holds the collected simulation results of a single action.
+type ActionData struct {
+	Run               int
+	Won               int
+	Survived          int
+	SurvivedSquared   int64
+	SurvivdedOpponent int
+	Round             int
+	Survival          SurvivalHistogram
+	LongestOpponent   int
+}
+
+const (
+	// engineEarlyStopCheck is the number of results after which Run checks for a dominant action.
+	engineEarlyStopCheck = 64
+	// engineProgressInterval is the interval in which Run reports the progress.
+	engineProgressInterval = 100 * time.Millisecond
+)
+
+// Worker numbers of workerRandom which do not belong to the simulations of a round.
+const (
+	// randomEndgame is used by the endgame search.
+	randomEndgame = -1
+	// randomPonder samples the opponent replies while pondering. Pondering worker i uses randomPonder-1-i so that pondered and regular simulations never share a source.
+	randomPonder = -2
+)
+
+// ProgressData is a snapshot of a running decision.
+type ProgressData struct {
+	Round      int
+	Runs       map[string]int
+	Leader     string // Action with the highest win chance so far
+	WinChances map[string]float64
+	Elapsed    time.Duration // Time since the start of the simulations
+	Available  time.Duration // Time available for the simulations, 0 if unknown
+}
+
+// Engine runs the simulations of a game state and selects the best action.
+type Engine struct {
+	Workers    int
+	Pool       *WorkerPool // Runs the local simulations instead of Workers if not nil
+	Remote     []*remoteWorker
+	Rollout    string                   // Name of the AI used in the simulations, SuperRandomAI if empty
+	Parameters *Parameters              // DefaultParameters if nil
+	Heatmap    bool                     // Record a heatmap of the local simulations into GameData
+	Progress   func(ProgressData)       // Called periodically while running if not nil
+	MaxRuns    int                      // Run returns after this number of simulations if not 0
+	Profiles   map[int]*OpponentProfile // Profiles of known opponents by player id, used in the local and remote simulations
+	Seed       int64                    // Seeds the random sources of the local workers if not 0 (see workerRandom)
+}
+
+// newGameData returns an empty GameData for the given game and round.
+func newGameData(g *Game, round int) GameData {
+	return GameData{
+		Alive:            g.Players[g.You].Active,
+		Collect:          make(map[string]ActionData),
+		Safety:           g.classifyActions(),
+		LongestWin:       0,
+		LongestWinAction: "",
+		Longest:          0,
+		LongestAction:    "",
+		Action:           "nothing",
+		Reason:           "",
+		Round:            round,
+		Game:             g,
+	}
+}
+
+// collect adds a single simulation result to the data.
+func (gd *GameData) collect(r struct {
+	action            string
+	win               bool
+	survived          int
+	survivdedOpponent int
+	round             int
+}) {
+	d := gd.Collect[r.action]
+	d.Run++
+	if r.win {
+		d.Won++
+		if r.survived > gd.LongestWin {
+			gd.LongestWin = r.survived
+			gd.LongestWinAction = r.action
+		}
+	}
+	if r.survived > gd.Longest {
+		gd.Longest = r.survived
+		gd.LongestAction = r.action
+	}
+	if r.survivdedOpponent > d.LongestOpponent {
+		d.LongestOpponent = r.survivdedOpponent
+	}
+	d.Survived += r.survived
+	d.SurvivedSquared += int64(r.survived) * int64(r.survived)
+	d.SurvivdedOpponent += r.survivdedOpponent
+	d.Round += r.round
+	d.Survival.Add(r.survived)
+	gd.Collect[r.action] = d
+}
+
+// merge adds all simulation results of other to the data.
+// Both must belong to the same game state.
+func (gd *GameData) merge(other GameData) {
+	for k := range other.Collect {
+		d := gd.Collect[k]
+		o := other.Collect[k]
+		d.Run += o.Run
+		d.Won += o.Won
+		d.Survived += o.Survived
+		d.SurvivedSquared += o.SurvivedSquared
+		d.SurvivdedOpponent += o.SurvivdedOpponent
+		d.Round += o.Round
+		d.Survival.Merge(&o.Survival)
+		if o.LongestOpponent > d.LongestOpponent {
+			d.LongestOpponent = o.LongestOpponent
+		}
+		gd.Collect[k] = d
+	}
+	if other.LongestWin > gd.LongestWin {
+		gd.LongestWin = other.LongestWin
+		gd.LongestWinAction = other.LongestWinAction
+	}
+	if other.Longest > gd.Longest {
+		gd.Longest = other.Longest
+		gd.LongestAction = other.LongestAction
+	}
+}
+
+// decide selects the action based on the collected data and sets Action and Reason.
+func (gd *GameData) decide(p *Parameters) {
+	if gd.Action == "nothing" {
+		var candidates []string
+		best := 0.0
+		for k := range gd.Collect {
+			d := gd.Collect[k]
+			if d.Run == 0 || gd.Safety[k] == SafetyFatal {
+				continue
+			}
+			winchance := d.WinChance()
+			if winchance > p.WinThreshold {
+				candidates = append(candidates, k)
+				if winchance > best {
+					gd.Reason = fmt.Sprintf("win > %.0f%%", p.WinThreshold*100)
+					gd.Action = k
+					best = winchance
+				}
+			}
+		}
+		if tie := gd.breakTie(gd.Action, candidates, ActionData.WinInterval, ActionData.AverageLength); tie != gd.Action {
+			gd.Action = tie
+			gd.Reason += " (tie: average length)"
+		}
+	}
+
+	if gd.Action == "nothing" {
+		var candidates []string
+		best := 0.0
+		for k := range gd.Collect {
+			d := gd.Collect[k]
+			if d.Run == 0 || gd.Safety[k] == SafetyFatal {
+				continue
+			}
+			averageLength := d.AverageLength()
+			if d.WinChance() > p.WinGate {
+				candidates = append(candidates, k)
+				if averageLength > best {
+					best = averageLength
+					gd.Action = k
+					gd.Reason = "average length"
+				}
+			}
+		}
+		if tie := gd.breakTie(gd.Action, candidates, ActionData.LengthInterval, ActionData.WinChance); tie != gd.Action {
+			gd.Action = tie
+			gd.Reason += " (tie: win chance)"
+		}
+	}
+
+	if gd.Action == "nothing" {
+		// In case no win path is found
+		if gd.LongestAction != "" && gd.Safety[gd.LongestAction] != SafetyFatal {
+			gd.Action = gd.LongestAction
+			gd.Reason = "longest path"
+		}
+	}
+
+	if gd.Action == "nothing" {
+		gd.Action = ActionNOOP
+		gd.Reason = "fallback"
+		// Prefer an action which might survive
+	fallback:
+		for _, safety := range []Safety{SafetySafe, SafetyPossiblyFatal} {
+			for _, a := range []string{ActionNOOP, ActionTurnLeft, ActionTurnRight, ActionSlower, ActionFaster} {
+				if gd.Safety[a] == safety {
+					gd.Action = a
+					break fallback
+				}
+			}
+		}
+	}
+
+	gd.Ties = gd.Ties[:0]
+	if d, ok := gd.Collect[gd.Action]; ok {
+		for k := range gd.Collect {
+			if k != gd.Action && gd.Collect[k].Run > 0 && indistinguishable(d, gd.Collect[k]) {
+				gd.Ties = append(gd.Ties, k)
+			}
+		}
+		sort.Strings(gd.Ties)
+	}
+}
+
+// breakTie returns the candidate with the highest value out of all candidates whose interval overlaps with the interval of best.
+// If best is not a candidate, best is returned.
+func (gd *GameData) breakTie(best string, candidates []string, interval func(ActionData) (float64, float64), value func(ActionData) float64) string {
+	d, ok := gd.Collect[best]
+	if !ok {
+		return best
+	}
+	selected := best
+	for _, k := range candidates {
+		if k == best || !overlap(d, gd.Collect[k], interval) {
+			continue
+		}
+		if value(gd.Collect[k]) > value(gd.Collect[selected]) {
+			selected = k
+		}
+	}
+	return selected
+}
+
+// params returns the parameters of the engine or DefaultParameters if none are set.
+func (e *Engine) params() *Parameters {
+	if e.Parameters == nil {
+		return &DefaultParameters
+	}
+	return e.Parameters
+}
+
+// Run simulates random games starting at g and collects the results into data.
+// Workers stop when ctxWorker is done, results are collected until ctxMain is done.
+// ctxWorker should be done before ctxMain so that all running simulations can be collected.
+// Run returns early if one action dominates all others (see Parameters.EarlyStopRuns) or after MaxRuns simulations.
+// If only one opponent is left and the position is not lost, the endgame search selects the action instead of the simulations (see Parameters.EndgameDepth).
+func (e *Engine) Run(ctxWorker, ctxMain context.Context, g *Game, data *GameData) {
+	if e.endgame(ctxWorker, g, data) {
+		return
+	}
+
+	ctxWorker, cancel := context.WithCancel(ctxWorker)
+	defer cancel()
+	// Workers still sending when Run returns early must not block
+	ctxMain, cancelMain := context.WithCancel(ctxMain)
+	defer cancelMain()
+
+	minRuns := e.params().EarlyStopRuns
+	collected := 0
+
+	start := time.Now()
+	var available time.Duration
+	if deadline, ok := ctxMain.Deadline(); ok {
+		available = deadline.Sub(start)
+	}
+	var progress <-chan time.Time
+	if e.Progress != nil {
+		ticker := time.NewTicker(engineProgressInterval)
+		defer ticker.Stop()
+		progress = ticker.C
+	}
+
+	results := make(chan struct {
+		action            string
+		win               bool
+		survived          int
+		survivdedOpponent int
+		round             int
+	}, e.Workers)
+
+	var heatmap *Heatmap
+	if e.Heatmap {
+		heatmap = newHeatmap(g.Width, g.Height)
+		defer func() {
+			if data.Heatmap == nil {
+				data.Heatmap = heatmap.clone()
+			} else {
+				data.Heatmap.merge(heatmap)
+			}
+		}()
+	}
+
+	done := e.simulate(ctxWorker, ctxMain, g, data.Round, heatmap, results)
+	defer func() {
+		// Workers must not use the game, the heatmap or their random sources after Run returned
+		cancel()
+		cancelMain()
+		<-done
+	}()
+	for i := range e.Remote {
+		go e.Remote[i].simulate(ctxWorker, ctxMain, g, e.Rollout, e.Parameters, e.Profiles, results)
+	}
+
+	for {
+		select {
+		case r := <-results:
+			data.collect(r)
+			collected++
+			if e.MaxRuns > 0 && collected >= e.MaxRuns {
+				return
+			}
+			if minRuns > 0 && collected%engineEarlyStopCheck == 0 {
+				if _, ok := data.dominant(minRuns); ok {
+					data.EarlyStop = true
+					return
+				}
+			}
+		case <-progress:
+			p := ProgressData{
+				Round:      data.Round,
+				Runs:       make(map[string]int, len(data.Collect)),
+				WinChances: make(map[string]float64, len(data.Collect)),
+				Leader:     data.leader(),
+				Elapsed:    time.Now().Sub(start),
+				Available:  available,
+			}
+			for k := range data.Collect {
+				p.Runs[k] = data.Collect[k].Run
+				p.WinChances[k] = data.Collect[k].WinChance()
+			}
+			e.Progress(p)
+		case <-ctxMain.Done():
+			return
+		}
+	}
+}
+
+// simulate starts the local workers which simulate g in the given round until ctxWorker is done.
+// Results are sent to the provided channel until ctxMain is done, so that simulations running at the worker deadline are not lost.
+// If heatmap is not nil, all simulations are recorded into it.
+// It does not block. The returned channel is closed after all workers have stopped.
+func (e *Engine) simulate(ctxWorker, ctxMain context.Context, g *Game, round int, heatmap *Heatmap, results chan<- struct {
+	action            string
+	win               bool
+	survived          int
+	survivdedOpponent int
+	round             int
+}) <-chan struct{} {
+	sampler := newRootSampler(g, e.params().Exploration)
+	sources := make([]randomSource, e.workerCount())
+	for i := range sources {
+		sources[i] = e.workerRandom(round, i)
+	}
+	step := func(worker int) {
+		local := make(chan struct {
+			action            string
+			win               bool
+			survived          int
+			survivdedOpponent int
+			round             int
+		}, 1)
+		ng := g.PublicCopy()
+		ng.rollout = aiConstructors[e.Rollout]
+		ng.parameters = e.Parameters
+		ng.heatmap = heatmap
+		ng.profiles = e.Profiles
+		ng.source = sources[worker]
+		a := sampler.next()
+		ng.SimulateGame(sampler.actions[a], local)
+		r := <-local
+		sampler.update(a, r.win, r.survived)
+		select {
+		case results <- r:
+		case <-ctxMain.Done():
+		}
+	}
+	return e.run(ctxWorker, step)
+}
+
+// workerCount returns the number of workers calling the steps of run.
+func (e *Engine) workerCount() int {
+	if e.Pool != nil {
+		return e.Pool.workers
+	}
+	return e.Workers
+}
+
+// workerRandom returns the random source of a worker in the given round.
+// If Seed is set, it is seeded from the seed, the round and the worker so that every round can be reproduced on its own.
+// Otherwise the global source is used.
+func (e *Engine) workerRandom(round, worker int) randomSource {
+	if e.Seed == 0 {
+		return globalRandom{}
+	}
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, [3]int64{e.Seed, int64(round), int64(worker)})
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+// run calls step repeatedly on the pool or on the local workers until ctx is done.
+// step receives the number of the calling worker, which is smaller than workerCount. Calls with the same number never run concurrently.
+// It does not block. The returned channel is closed after all calls of step have returned.
+func (e *Engine) run(ctx context.Context, step func(worker int)) <-chan struct{} {
+	if e.Pool != nil {
+		return e.Pool.Run(ctx, step)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < e.Workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+					step(i)
+				}
+			}
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
@@ -15,16 +15,47 @@
 
 package main
 
-const (
+import (
+	"errors"
+	"math/rand"
+)
+
+// Rules holds the rule parameters of a game. Variants of the game can be played by changing them.
+type Rules struct {
 	// FieldMaxSize contains the maximum size of the field (both width and height).
-	FieldMaxSize = 80
+	FieldMaxSize int `json:"fieldMaxSize"`
 	// HolesEachStep holds after how many steps a hole might occur (if the preconditions are met).
-	HolesEachStep = 6
+	HolesEachStep int `json:"holesEachStep"`
 	// HoleSpeed contains the minimum speed needed for a hole.
-	HoleSpeed = 3
+	HoleSpeed int `json:"holeSpeed"`
 	// MaxSpeed holds the maximum speed.
-	MaxSpeed = 10
-)
+	MaxSpeed int `json:"maxSpeed"`
+}
+
+// DefaultRules are the rules of the informatiCup 2021.
+var DefaultRules = Rules{
+	FieldMaxSize:  80,
+	HolesEachStep: 6,
+	HoleSpeed:     3,
+	MaxSpeed:      10,
+}
+
+// Validate checks the rules for errors.
+func (r Rules) Validate() error {
+	if r.FieldMaxSize < 1 {
+		return errors.New("rules: fieldMaxSize must be at least 1")
+	}
+	if r.HolesEachStep < 1 {
+		return errors.New("rules: holesEachStep must be at least 1")
+	}
+	if r.HoleSpeed < 1 {
+		return errors.New("rules: holeSpeed must be at least 1")
+	}
+	if r.MaxSpeed < 1 {
+		return errors.New("rules: maxSpeed must be at least 1")
+	}
+	return nil
+}
 
 // Game represents a game of speed. See https://github.com/informatiCup/InformatiCup2021/ for a description of the game.
 // This struct is a modified from the server version to fit sl_ow.
@@ -36,8 +67,14 @@ type Game struct {
 	You               int             `json:"you"` // only needed for protocol, ignored everywhere else
 	Running           bool            `json:"running"`
 	Deadline          string          `json:"deadline,omitempty"` // RFC3339
+	Rules             *Rules          `json:"rules,omitempty"`    // Not sent by the official server, DefaultRules if nil
 	playerAnswer      []string
 	freeCountingSlice []bool
+	rollout           func() AI                // AI used for all players in SimulateGame, SuperRandomAI if nil
+	parameters        *Parameters              // DefaultParameters if nil
+	heatmap           *Heatmap                 // Records the simulated games if not nil
+	profiles          map[int]*OpponentProfile // Opponents with a profile are played by ProfileAI in SimulateGame
+	source            randomSource             // Random source of SimulateGame and the AIs, the global source if nil
 
 	internalCellsFlat []int8
 }
@@ -51,18 +88,8 @@ func (g *Game) SimulateGame(next string, result chan<- struct {
 	survivdedOpponent int
 	round             int
 }) {
-	// Check speed
-	if next == ActionSlower && g.Players[g.You].Speed == 1 {
-		result <- struct {
-			action            string
-			win               bool
-			survived          int
-			survivdedOpponent int
-			round             int
-		}{next, false, 0, 0, 0}
-		return
-	}
-	if next == ActionFaster && g.Players[g.You].Speed == MaxSpeed {
+	// Check speed and certain crashes
+	if g.classifyAction(next) == SafetyFatal {
 		result <- struct {
 			action            string
 			win               bool
@@ -73,8 +100,21 @@ func (g *Game) SimulateGame(next string, result chan<- struct {
 		return
 	}
 
+	rollout := func() AI { return &SuperRandomAI{} }
+	if g.rollout != nil {
+		rollout = func() AI { return &answeringAI{AI: g.rollout()} }
+	}
 	for k := range g.Players {
-		g.Players[k].ai = &SuperRandomAI{}
+		if profile, ok := g.profiles[k]; ok && k != g.You {
+			g.Players[k].ai = &answeringAI{AI: &ProfileAI{Profile: profile, Fallback: rollout()}}
+			continue
+		}
+		g.Players[k].ai = rollout()
+	}
+
+	var before []Player
+	if g.heatmap != nil {
+		before = make([]Player, len(g.Players)+1)
 	}
 
 	first := true
@@ -129,117 +169,16 @@ mainGame:
 
 		first = false
 
-		// Process Actions
-		for i := range g.Players {
-			switch g.playerAnswer[i-1] {
-			case "":
-				g.invalidatePlayer(i)
-			case ActionTurnLeft:
-				switch g.Players[i].Direction {
-				case DirectionLeft:
-					g.Players[i].Direction = DirectionDown
-				case DirectionRight:
-					g.Players[i].Direction = DirectionUp
-				case DirectionUp:
-					g.Players[i].Direction = DirectionLeft
-				case DirectionDown:
-					g.Players[i].Direction = DirectionRight
-				}
-			case ActionTurnRight:
-				switch g.Players[i].Direction {
-				case DirectionLeft:
-					g.Players[i].Direction = DirectionUp
-				case DirectionRight:
-					g.Players[i].Direction = DirectionDown
-				case DirectionUp:
-					g.Players[i].Direction = DirectionRight
-				case DirectionDown:
-					g.Players[i].Direction = DirectionLeft
-				}
-			case ActionFaster:
-				g.Players[i].Speed++
-				if g.Players[i].Speed > MaxSpeed {
-					g.invalidatePlayer(i)
-				}
-			case ActionSlower:
-				g.Players[i].Speed--
-				if g.Players[i].Speed < 1 {
-					g.invalidatePlayer(i)
-				}
-			case ActionNOOP:
-				// Do nothing
-			default:
-				g.invalidatePlayer(i)
-			}
-		}
-
-		// Do Movement
-		for i := range g.Players {
-			if !g.Players[i].Active {
-				continue
-			}
-			var dostep func(x, y int) (int, int)
-			switch g.Players[i].Direction {
-			case DirectionUp:
-				dostep = func(x, y int) (int, int) { return x, y - 1 }
-			case DirectionDown:
-				dostep = func(x, y int) (int, int) { return x, y + 1 }
-			case DirectionLeft:
-				dostep = func(x, y int) (int, int) { return x - 1, y }
-			case DirectionRight:
-				dostep = func(x, y int) (int, int) { return x + 1, y }
-			}
-
-			g.Players[i].stepCounter++
-
-			for s := 0; s < g.Players[i].Speed; s++ {
-				g.Players[i].X, g.Players[i].Y = dostep(g.Players[i].X, g.Players[i].Y)
-				if g.Players[i].X < 0 || g.Players[i].X >= g.Width || g.Players[i].Y < 0 || g.Players[i].Y >= g.Height {
-					g.invalidatePlayer(i)
-					break
-				}
-				if g.Players[i].Speed >= HoleSpeed && g.Players[i].stepCounter%HolesEachStep == 0 && s != 0 && s != g.Players[i].Speed-1 {
-					continue
-				}
-				if g.Cells[g.Players[i].Y][g.Players[i].X] != 0 {
-					g.Cells[g.Players[i].Y][g.Players[i].X] = -1
-				} else {
-					g.Cells[g.Players[i].Y][g.Players[i].X] = int8(i)
-				}
-			}
-		}
-
-		// Check crash
-		for i := range g.Players {
-			if !g.Players[i].Active {
-				continue
-			}
-			var dostepback func(x, y int) (int, int)
-			switch g.Players[i].Direction {
-			case DirectionUp:
-				dostepback = func(x, y int) (int, int) { return x, y + 1 }
-			case DirectionDown:
-				dostepback = func(x, y int) (int, int) { return x, y - 1 }
-			case DirectionLeft:
-				dostepback = func(x, y int) (int, int) { return x + 1, y }
-			case DirectionRight:
-				dostepback = func(x, y int) (int, int) { return x - 1, y }
-			}
-
-			backX := g.Players[i].X
-			backY := g.Players[i].Y
-			for s := 0; s < g.Players[i].Speed; s++ {
-				if g.Cells[backY][backX] == -1 {
-					// Crash - check hole
-					if g.Players[i].Speed >= HoleSpeed && g.Players[i].stepCounter%HolesEachStep == 0 && s != 0 && s != g.Players[i].Speed-1 {
-						// No crash - is hole
-					} else {
-						g.invalidatePlayer(i)
-						break
-					}
+		if g.heatmap != nil {
+			for i := range g.Players {
+				if i < len(before) {
+					before[i] = *g.Players[i]
 				}
-				backX, backY = dostepback(backX, backY)
 			}
+			g.processRound()
+			g.heatmap.recordRound(g, before)
+		} else {
+			g.processRound()
 		}
 
 		if winner == -1 {
@@ -282,6 +221,123 @@ mainGame:
 	}{next, winner == g.You, survived, survivedOpponent, round}
 }
 
+// processRound applies the actions in playerAnswer to all players and moves them according to the rules.
+// Crashed players are set to inactive.
+func (g *Game) processRound() {
+	// Process Actions
+	for i := range g.Players {
+		switch g.playerAnswer[i-1] {
+		case "":
+			g.invalidatePlayer(i)
+		case ActionTurnLeft:
+			switch g.Players[i].Direction {
+			case DirectionLeft:
+				g.Players[i].Direction = DirectionDown
+			case DirectionRight:
+				g.Players[i].Direction = DirectionUp
+			case DirectionUp:
+				g.Players[i].Direction = DirectionLeft
+			case DirectionDown:
+				g.Players[i].Direction = DirectionRight
+			}
+		case ActionTurnRight:
+			switch g.Players[i].Direction {
+			case DirectionLeft:
+				g.Players[i].Direction = DirectionUp
+			case DirectionRight:
+				g.Players[i].Direction = DirectionDown
+			case DirectionUp:
+				g.Players[i].Direction = DirectionRight
+			case DirectionDown:
+				g.Players[i].Direction = DirectionLeft
+			}
+		case ActionFaster:
+			g.Players[i].Speed++
+			if g.Players[i].Speed > g.rules().MaxSpeed {
+				g.invalidatePlayer(i)
+			}
+		case ActionSlower:
+			g.Players[i].Speed--
+			if g.Players[i].Speed < 1 {
+				g.invalidatePlayer(i)
+			}
+		case ActionNOOP:
+			// Do nothing
+		default:
+			g.invalidatePlayer(i)
+		}
+	}
+
+	// Do Movement
+	for i := range g.Players {
+		if !g.Players[i].Active {
+			continue
+		}
+		var dostep func(x, y int) (int, int)
+		switch g.Players[i].Direction {
+		case DirectionUp:
+			dostep = func(x, y int) (int, int) { return x, y - 1 }
+		case DirectionDown:
+			dostep = func(x, y int) (int, int) { return x, y + 1 }
+		case DirectionLeft:
+			dostep = func(x, y int) (int, int) { return x - 1, y }
+		case DirectionRight:
+			dostep = func(x, y int) (int, int) { return x + 1, y }
+		}
+
+		g.Players[i].stepCounter++
+
+		for s := 0; s < g.Players[i].Speed; s++ {
+			g.Players[i].X, g.Players[i].Y = dostep(g.Players[i].X, g.Players[i].Y)
+			if g.Players[i].X < 0 || g.Players[i].X >= g.Width || g.Players[i].Y < 0 || g.Players[i].Y >= g.Height {
+				g.invalidatePlayer(i)
+				break
+			}
+			if g.Players[i].Speed >= g.rules().HoleSpeed && g.Players[i].stepCounter%g.rules().HolesEachStep == 0 && s != 0 && s != g.Players[i].Speed-1 {
+				continue
+			}
+			if g.Cells[g.Players[i].Y][g.Players[i].X] != 0 {
+				g.Cells[g.Players[i].Y][g.Players[i].X] = -1
+			} else {
+				g.Cells[g.Players[i].Y][g.Players[i].X] = int8(i)
+			}
+		}
+	}
+
+	// Check crash
+	for i := range g.Players {
+		if !g.Players[i].Active {
+			continue
+		}
+		var dostepback func(x, y int) (int, int)
+		switch g.Players[i].Direction {
+		case DirectionUp:
+			dostepback = func(x, y int) (int, int) { return x, y + 1 }
+		case DirectionDown:
+			dostepback = func(x, y int) (int, int) { return x, y - 1 }
+		case DirectionLeft:
+			dostepback = func(x, y int) (int, int) { return x + 1, y }
+		case DirectionRight:
+			dostepback = func(x, y int) (int, int) { return x - 1, y }
+		}
+
+		backX := g.Players[i].X
+		backY := g.Players[i].Y
+		for s := 0; s < g.Players[i].Speed; s++ {
+			if g.Cells[backY][backX] == -1 {
+				// Crash - check hole
+				if g.Players[i].Speed >= g.rules().HoleSpeed && g.Players[i].stepCounter%g.rules().HolesEachStep == 0 && s != 0 && s != g.Players[i].Speed-1 {
+					// No crash - is hole
+				} else {
+					g.invalidatePlayer(i)
+					break
+				}
+			}
+			backX, backY = dostepback(backX, backY)
+		}
+	}
+}
+
 func (g *Game) checkEndGame() bool {
 	numberActive := 0
 	for i := range g.Players {
@@ -301,7 +357,8 @@ func (g *Game) invalidatePlayer(p int) {
 }
 
 // PublicCopy returns a copy of the game with all private fields set to zero.
-// As an exception for AIs, Player.stepCounter is also copied.
+// As an exception for AIs, Player.stepCounter, the parameters and the random source are also copied.
+// The rules are shared with the copy.
 func (g Game) PublicCopy() *Game {
 	newG := Game{
 		Width:    g.Width,
@@ -311,6 +368,10 @@ func (g Game) PublicCopy() *Game {
 		You:      g.You,
 		Running:  g.Running,
 		Deadline: g.Deadline,
+		Rules:    g.Rules,
+
+		parameters: g.parameters,
+		source:     g.source,
 	}
 
 	if g.internalCellsFlat == nil {
@@ -420,3 +481,37 @@ func (g *Game) PopulateInternalCellsFlat() {
 		g.Cells[y] = g.internalCellsFlat[y*g.Width : (y+1)*g.Width]
 	}
 }
+
+// rules returns the rules of the game or DefaultRules if none are set.
+// randomSource is the part of *rand.Rand used by the simulations and the AIs.
+type randomSource interface {
+	Int63() int64
+	Intn(n int) int
+	Float32() float32
+	Float64() float64
+	Shuffle(n int, swap func(i, j int))
+}
+
+// globalRandom uses the global source of math/rand, which is safe for concurrent use.
+type globalRandom struct{}
+
+func (globalRandom) Int63() int64                       { return rand.Int63() }
+func (globalRandom) Intn(n int) int                     { return rand.Intn(n) }
+func (globalRandom) Float32() float32                   { return rand.Float32() }
+func (globalRandom) Float64() float64                   { return rand.Float64() }
+func (globalRandom) Shuffle(n int, swap func(i, j int)) { rand.Shuffle(n, swap) }
+
+// random returns the random source of the game. AIs must use it so that seeded simulations can be reproduced.
+func (g *Game) random() randomSource {
+	if g.source == nil {
+		return globalRandom{}
+	}
+	return g.source
+}
+
+func (g *Game) rules() *Rules {
+	if g.Rules == nil {
+		return &DefaultRules
+	}
+	return g.Rules
+}
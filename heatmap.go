@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync/atomic"
+)
+
+// Heatmap counts per cell where the simulated games passed through and where players died.
+// Cells are stored row by row (y*Width+x). Recording is safe for concurrent use.
+type Heatmap struct {
+	Width          int
+	Height         int
+	Deaths         []uint32 // Deaths of the own player
+	Visits         []uint32 // Cells passed by the own player
+	OpponentDeaths []uint32 // Deaths of all opponents
+}
+
+// heatmapLayers holds the names of all layers of the heatmap in display order.
+var heatmapLayers = []string{"deaths", "visits", "opponent deaths"}
+
+// newHeatmap returns an empty heatmap for a board of the given size.
+func newHeatmap(width, height int) *Heatmap {
+	return &Heatmap{
+		Width:          width,
+		Height:         height,
+		Deaths:         make([]uint32, width*height),
+		Visits:         make([]uint32, width*height),
+		OpponentDeaths: make([]uint32, width*height),
+	}
+}
+
+// Layer returns the counts of a layer (see heatmapLayers) or nil if the layer is unknown.
+func (h *Heatmap) Layer(name string) []uint32 {
+	switch name {
+	case "deaths":
+		return h.Deaths
+	case "visits":
+		return h.Visits
+	case "opponent deaths":
+		return h.OpponentDeaths
+	}
+	return nil
+}
+
+// recordRound adds the movement of the last round. before holds the players by id before the round.
+// Players which did not move (e.g. invalidated because of their speed) are skipped.
+func (h *Heatmap) recordRound(g *Game, before []Player) {
+	for i, p := range g.Players {
+		if i >= len(before) || !before[i].Active || (p.X == before[i].X && p.Y == before[i].Y) {
+			continue
+		}
+		dx, dy := 0, 0
+		switch p.Direction {
+		case DirectionUp:
+			dy = 1
+		case DirectionDown:
+			dy = -1
+		case DirectionLeft:
+			dx = 1
+		case DirectionRight:
+			dx = -1
+		}
+
+		// Walk back to find the last cell on the board and all passed cells
+		x, y := p.X, p.Y
+		last := -1
+		for s := 0; s < p.Speed; s++ {
+			if x >= 0 && x < h.Width && y >= 0 && y < h.Height {
+				if last == -1 {
+					last = y*h.Width + x
+				}
+				if i == g.You {
+					atomic.AddUint32(&h.Visits[y*h.Width+x], 1)
+				}
+			}
+			x, y = x+dx, y+dy
+		}
+
+		if p.Active || last == -1 {
+			continue
+		}
+		if i == g.You {
+			atomic.AddUint32(&h.Deaths[last], 1)
+		} else {
+			atomic.AddUint32(&h.OpponentDeaths[last], 1)
+		}
+	}
+}
+
+// merge adds all counts of other. Both heatmaps must have the same size.
+func (h *Heatmap) merge(other *Heatmap) {
+	if other == nil || other.Width != h.Width || other.Height != h.Height {
+		return
+	}
+	for i := range h.Deaths {
+		h.Deaths[i] += atomic.LoadUint32(&other.Deaths[i])
+		h.Visits[i] += atomic.LoadUint32(&other.Visits[i])
+		h.OpponentDeaths[i] += atomic.LoadUint32(&other.OpponentDeaths[i])
+	}
+}
+
+// clone returns a copy of the heatmap. It is safe to call while recording.
+func (h *Heatmap) clone() *Heatmap {
+	c := newHeatmap(h.Width, h.Height)
+	c.merge(h)
+	return c
+}
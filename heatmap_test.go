@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestHeatmapRecordRound(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		visits int
+		deaths int
+	}{
+		{"move", ActionNOOP, 1, 0},
+		{"wall", ActionFaster, 1, 1},
+		{"invalid speed", ActionSlower, 0, 0},
+		{"no answer", "", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Player 1 at (1,5) going left at speed 1, speeding up leaves the board after one cell
+			g := classifyTestGame(1, 5, DirectionLeft, 1, 1)
+			h := newHeatmap(g.Width, g.Height)
+			before := make([]Player, len(g.Players)+1)
+			for i := range g.Players {
+				before[i] = *g.Players[i]
+			}
+			g.playerAnswer = []string{tt.action, ""}
+			g.processRound()
+			h.recordRound(g, before)
+
+			visits, deaths := 0, 0
+			for i := range h.Visits {
+				visits += int(h.Visits[i])
+				deaths += int(h.Deaths[i])
+			}
+			if visits != tt.visits || deaths != tt.deaths {
+				t.Errorf("%d visits, %d deaths, want %d, %d", visits, deaths, tt.visits, tt.deaths)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+)
+
+const (
+	// histogramLinear is the number of values counted exactly.
+	histogramLinear = 128
+	// histogramSubBuckets is the number of buckets per doubling above histogramLinear.
+	histogramSubBuckets = 8
+	// histogramOctaves is the number of doublings above histogramLinear. Larger values are counted in the last bucket.
+	histogramOctaves = 13
+	// histogramBuckets is the total number of buckets.
+	histogramBuckets = histogramLinear + histogramOctaves*histogramSubBuckets
+)
+
+// SurvivalHistogram counts the survived rounds of simulations in bounded memory.
+// Values below 128 are counted exactly, larger values in buckets with a width of at most 1/8 of their value.
+// Histograms can be merged, e.g. to combine the results of several workers.
+type SurvivalHistogram struct {
+	Counts [histogramBuckets]uint32
+	Total  int
+}
+
+// histogramBucket returns the bucket of a value.
+func histogramBucket(v int) int {
+	if v < 0 {
+		return 0
+	}
+	if v < histogramLinear {
+		return v
+	}
+	octave := 0
+	for low := histogramLinear; v >= 2*low; low *= 2 {
+		octave++
+	}
+	if octave >= histogramOctaves {
+		return histogramBuckets - 1
+	}
+	low := histogramLinear << octave
+	return histogramLinear + octave*histogramSubBuckets + (v-low)*histogramSubBuckets/low
+}
+
+// histogramBucketRange returns the smallest value of a bucket and the smallest value of the next bucket.
+func histogramBucketRange(b int) (int, int) {
+	if b < histogramLinear {
+		return b, b + 1
+	}
+	octave := (b - histogramLinear) / histogramSubBuckets
+	sub := (b - histogramLinear) % histogramSubBuckets
+	low := histogramLinear << octave
+	width := low / histogramSubBuckets
+	return low + sub*width, low + (sub+1)*width
+}
+
+// Add counts a simulation which survived the given number of rounds.
+func (h *SurvivalHistogram) Add(rounds int) {
+	h.Counts[histogramBucket(rounds)]++
+	h.Total++
+}
+
+// Merge adds all counts of o.
+func (h *SurvivalHistogram) Merge(o *SurvivalHistogram) {
+	for i := range o.Counts {
+		h.Counts[i] += o.Counts[i]
+	}
+	h.Total += o.Total
+}
+
+// Quantile returns the smallest number of rounds such that at least the share q of all simulations survived at most this number of rounds.
+// Inside buckets wider than one round the value is interpolated. Returns 0 for an empty histogram.
+func (h *SurvivalHistogram) Quantile(q float64) int {
+	if h.Total == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(q * float64(h.Total)))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > h.Total {
+		rank = h.Total
+	}
+	seen := 0
+	for b := range h.Counts {
+		c := int(h.Counts[b])
+		if seen+c < rank {
+			seen += c
+			continue
+		}
+		low, high := histogramBucketRange(b)
+		return low + (rank-seen-1)*(high-low)/c
+	}
+	return 0
+}
+
+// Survival returns the share of simulations which survived at least the given number of rounds.
+// Inside buckets wider than one round the share is interpolated.
+func (h *SurvivalHistogram) Survival(rounds int) float64 {
+	if h.Total == 0 {
+		return 0
+	}
+	survived := 0.0
+	for b := len(h.Counts) - 1; b >= 0; b-- {
+		low, high := histogramBucketRange(b)
+		if high <= rounds {
+			break
+		}
+		if low < rounds {
+			survived += float64(h.Counts[b]) * float64(high-rounds) / float64(high-low)
+			break
+		}
+		survived += float64(h.Counts[b])
+	}
+	return survived / float64(h.Total)
+}
+
+// SurvivalPoint is a point of the survival curve.
+type SurvivalPoint struct {
+	Rounds   int     `json:"rounds"`
+	Survival float64 `json:"survival"` // Share of simulations which survived at least Rounds
+}
+
+// Curve returns the survival curve at the start of every non-empty bucket.
+func (h *SurvivalHistogram) Curve() []SurvivalPoint {
+	if h.Total == 0 {
+		return nil
+	}
+	var curve []SurvivalPoint
+	remaining := h.Total
+	for b := range h.Counts {
+		if h.Counts[b] == 0 {
+			continue
+		}
+		low, _ := histogramBucketRange(b)
+		curve = append(curve, SurvivalPoint{Rounds: low, Survival: float64(remaining) / float64(h.Total)})
+		remaining -= int(h.Counts[b])
+	}
+	return curve
+}
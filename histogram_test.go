@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestHistogramBucket(t *testing.T) {
+	last := histogramBuckets - 1
+	tests := []struct {
+		value  int
+		bucket int
+	}{
+		{-1, 0},
+		{0, 0},
+		{1, 1},
+		{127, 127},
+		{128, 128},
+		{143, 128},
+		{144, 129},
+		{255, 135},
+		{256, 136},
+		{287, 136},
+		{288, 137},
+		{511, 143},
+		{512, 144},
+		{histogramLinear<<histogramOctaves - 1, last},
+		{histogramLinear << histogramOctaves, last},
+		{1 << 30, last},
+	}
+	for _, tt := range tests {
+		if b := histogramBucket(tt.value); b != tt.bucket {
+			t.Errorf("histogramBucket(%d) = %d, want %d", tt.value, b, tt.bucket)
+		}
+	}
+}
+
+func TestHistogramBucketRange(t *testing.T) {
+	next := 0
+	for b := 0; b < histogramBuckets; b++ {
+		low, high := histogramBucketRange(b)
+		if low != next {
+			t.Fatalf("bucket %d starts at %d, previous bucket ends at %d", b, low, next)
+		}
+		if high <= low {
+			t.Fatalf("bucket %d is empty: [%d, %d)", b, low, high)
+		}
+		if histogramBucket(low) != b || histogramBucket(high-1) != b {
+			t.Fatalf("bucket %d: range [%d, %d) maps to buckets %d and %d", b, low, high, histogramBucket(low), histogramBucket(high-1))
+		}
+		if low >= histogramLinear && (high-low)*histogramSubBuckets > low {
+			t.Errorf("bucket %d: width %d is larger than 1/%d of %d", b, high-low, histogramSubBuckets, low)
+		}
+		next = high
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var direct, a, b SurvivalHistogram
+	for i := 0; i < 10000; i++ {
+		v := r.Intn(5000)
+		direct.Add(v)
+		if i%3 == 0 {
+			a.Add(v)
+		} else {
+			b.Add(v)
+		}
+	}
+	a.Merge(&b)
+	if a != direct {
+		t.Error("merged histogram differs from adding directly")
+	}
+}
+
+func TestHistogramQuantileSurvival(t *testing.T) {
+	var h SurvivalHistogram
+	if h.Quantile(0.5) != 0 || h.Survival(10) != 0 {
+		t.Error("empty histogram")
+	}
+	for v := 0; v < 100; v++ {
+		h.Add(v)
+	}
+	if q := h.Quantile(0.5); q != 49 {
+		t.Errorf("median is %d, want 49", q)
+	}
+	if q := h.Quantile(1); q != 99 {
+		t.Errorf("maximum is %d, want 99", q)
+	}
+	if s := h.Survival(0); s != 1 {
+		t.Errorf("survival(0) is %f, want 1", s)
+	}
+	if s := h.Survival(90); s != 0.1 {
+		t.Errorf("survival(90) is %f, want 0.1", s)
+	}
+	if s := h.Survival(100); s != 0 {
+		t.Errorf("survival(100) is %f, want 0", s)
+	}
+}
@@ -0,0 +1,316 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// HistoryEntry is a finished game in the history (see -history).
+type HistoryEntry struct {
+	Time      time.Time `json:"time"`
+	Endpoint  string    `json:"endpoint"`
+	Won       bool      `json:"won"`
+	Survived  int       `json:"survived"` // Last round in which we were alive
+	Rounds    int       `json:"rounds"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	Opponents []string  `json:"opponents"` // Names of all opponents, empty if unknown
+	Runtime   Duration  `json:"runtime"`
+	Jumps     int       `json:"jumps"`
+	Config    string    `json:"config"` // See Config.Hash
+}
+
+// DefaultHistoryFile is the name of the history in the user configuration directory.
+const DefaultHistoryFile = "history.jsonl"
+
+// historyLock serialises writes of concurrent sessions.
+var historyLock sync.Mutex
+
+// appendHistory appends an entry as a single JSON line to file. Missing directories are created.
+func appendHistory(file string, e HistoryEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	historyLock.Lock()
+	defer historyLock.Unlock()
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadHistory reads all entries of file. Broken lines (e.g. from a crash while writing) are skipped.
+func loadHistory(file string) ([]HistoryEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		var e HistoryEntry
+		if json.Unmarshal(s.Bytes(), &e) != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, s.Err()
+}
+
+// historyUI appends the result of the game to the history.
+type historyUI struct {
+	File     string
+	Endpoint string
+	UI       UI
+	entry    HistoryEntry
+}
+
+func (h *historyUI) Initialise() error {
+	if h.UI != nil {
+		return h.UI.Initialise()
+	}
+	return nil
+}
+
+func (h *historyUI) NewRound(g *Game, round int) {
+	if h.UI != nil {
+		h.UI.NewRound(g, round)
+	}
+}
+
+func (h *historyUI) NewData(data GameData) {
+	if data.Game != nil {
+		if h.entry.Opponents == nil {
+			h.entry.Width, h.entry.Height = data.Game.Width, data.Game.Height
+			h.entry.Opponents = make([]string, 0, len(data.Game.Players))
+			for _, k := range data.Game.playerIDs() {
+				if k != data.Game.You {
+					h.entry.Opponents = append(h.entry.Opponents, data.Game.Players[k].Name)
+				}
+			}
+		}
+		h.entry.Runtime = Duration(data.Runtime)
+		h.entry.Jumps = data.Jumps
+		h.entry.Config = data.Config
+	}
+
+	if h.UI != nil {
+		h.UI.NewData(data)
+	}
+}
+
+func (h *historyUI) Progress(p ProgressData) {
+	if h.UI != nil {
+		h.UI.Progress(p)
+	}
+}
+
+func (h *historyUI) Finish(won bool, survived, round int) error {
+	var err error
+	if h.UI != nil {
+		err = h.UI.Finish(won, survived, round)
+	}
+
+	if h.entry.Opponents == nil || survived < 0 {
+		// Game did not start or was aborted
+		return err
+	}
+	h.entry.Time = time.Now()
+	h.entry.Endpoint = h.Endpoint
+	h.entry.Won = won
+	h.entry.Survived = survived
+	h.entry.Rounds = round
+	newErr := appendHistory(h.File, h.entry)
+	if newErr != nil && err != nil {
+		return fmt.Errorf("two errors: %s, %s", err.Error(), newErr.Error())
+	} else if newErr != nil {
+		err = newErr
+	}
+	return err
+}
+
+func (h *historyUI) Wait() {
+	if h.UI != nil {
+		h.UI.Wait()
+	}
+}
+
+// historyGroup collects the results of a group of games.
+type historyGroup struct {
+	Name     string
+	Games    int
+	Won      int
+	Survived int
+}
+
+// addHistoryGroup adds e to the group with the given name.
+func addHistoryGroup(groups map[string]*historyGroup, name string, e HistoryEntry) {
+	g, ok := groups[name]
+	if !ok {
+		g = &historyGroup{Name: name}
+		groups[name] = g
+	}
+	g.Games++
+	if e.Won {
+		g.Won++
+	}
+	g.Survived += e.Survived
+}
+
+// writeHistoryGroups writes the groups sorted by name as a table.
+func writeHistoryGroups(title string, groups map[string]*historyGroup) {
+	list := make([]*historyGroup, 0, len(groups))
+	for _, g := range groups {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	fmt.Println(title)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "\t\tgames\twon\twin rate\tCI\tmean survived\t")
+	for _, g := range list {
+		low, high := wilsonInterval(g.Won, g.Games, ConfidenceZ)
+		fmt.Fprintf(w, "\t%s\t%d\t%d\t%.2f\t[%.2f, %.2f]\t%.1f\t\n", g.Name, g.Games, g.Won, float64(g.Won)/float64(g.Games), low, high, float64(g.Survived)/float64(g.Games))
+	}
+	w.Flush()
+	fmt.Println()
+}
+
+// statsCommand prints win rates of the games in the history.
+func statsCommand(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	file := fs.String("history", defaultUserFile(DefaultHistoryFile), "History file (see -history)")
+	since := fs.String("since", "", "Only games since this date (YYYY-MM-DD)")
+	days := fs.Int("days", 0, "Only games of the last days, 0 for all")
+	endpoint := fs.String("endpoint", "", "Only games with an endpoint containing this string")
+	size := fs.String("size", "", "Only games with this board size (WIDTHxHEIGHT)")
+	opponent := fs.String("opponent", "", "Only games against an opponent with this name")
+	config := fs.String("config", "", "Only games with this configuration hash")
+	period := fs.String("period", "week", "Grouping of the win rate over time: day, week or month")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: sl_ow stats [flags]")
+		fmt.Fprintln(fs.Output(), "Prints the win rate over time, per board size and per opponent of all games in the history.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var from time.Time
+	if *since != "" {
+		var err error
+		from, err = time.ParseInLocation("2006-01-02", *since, time.Local)
+		if err != nil {
+			log.Fatalln("invalid since:", err)
+		}
+	}
+	if *days > 0 {
+		d := time.Now().AddDate(0, 0, -*days)
+		if d.After(from) {
+			from = d
+		}
+	}
+	periodName := map[string]func(t time.Time) string{
+		"day": func(t time.Time) string { return t.Format("2006-01-02") },
+		"week": func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", y, w)
+		},
+		"month": func(t time.Time) string { return t.Format("2006-01") },
+	}[*period]
+	if periodName == nil {
+		log.Fatalln("unknown period", *period)
+	}
+
+	entries, err := loadHistory(*file)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	total := make(map[string]*historyGroup)
+	overTime := make(map[string]*historyGroup)
+	sizes := make(map[string]*historyGroup)
+	opponents := make(map[string]*historyGroup)
+	for _, e := range entries {
+		t := e.Time.Local()
+		boardSize := fmt.Sprintf("%dx%d", e.Width, e.Height)
+		switch {
+		case t.Before(from):
+			continue
+		case *endpoint != "" && !strings.Contains(e.Endpoint, *endpoint):
+			continue
+		case *size != "" && boardSize != *size:
+			continue
+		case *config != "" && e.Config != *config:
+			continue
+		}
+		names := make(map[string]bool, len(e.Opponents))
+		for _, o := range e.Opponents {
+			if o == "" {
+				o = "unknown"
+			}
+			names[o] = true
+		}
+		if *opponent != "" && !names[*opponent] {
+			continue
+		}
+
+		addHistoryGroup(total, "all", e)
+		addHistoryGroup(overTime, periodName(t), e)
+		addHistoryGroup(sizes, boardSize, e)
+		for o := range names {
+			addHistoryGroup(opponents, o, e)
+		}
+	}
+	if len(total) == 0 {
+		fmt.Println("no games found")
+		return
+	}
+
+	writeHistoryGroups("total", total)
+	writeHistoryGroups("per "+*period, overTime)
+	writeHistoryGroups("per board size", sizes)
+	writeHistoryGroups("per opponent (games with this opponent)", opponents)
+}
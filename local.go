@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// newGame returns a running game with the given size.
+// All players start at random free positions with a random direction and speed 1, like on the server.
+func newGame(width, height, players int) *Game {
+	return newGameFrom(globalRandom{}, width, height, players)
+}
+
+// newGameFrom is like newGame, but all random decisions are taken from r. r also becomes the random source of the game (see Game.random).
+func newGameFrom(r randomSource, width, height, players int) *Game {
+	g := &Game{
+		Width:   width,
+		Height:  height,
+		Cells:   make([][]int8, height),
+		Players: make(map[int]*Player, players),
+		You:     1,
+		Running: true,
+		source:  r,
+	}
+	for y := range g.Cells {
+		g.Cells[y] = make([]int8, width)
+	}
+
+	directions := []string{DirectionUp, DirectionDown, DirectionLeft, DirectionRight}
+	for i := 1; i <= players; i++ {
+		x, y := r.Intn(width), r.Intn(height)
+		for g.Cells[y][x] != 0 {
+			x, y = r.Intn(width), r.Intn(height)
+		}
+		g.Players[i] = &Player{
+			X:         x,
+			Y:         y,
+			Direction: directions[r.Intn(len(directions))],
+			Speed:     1,
+			Active:    true,
+		}
+		g.Cells[y][x] = int8(i)
+	}
+
+	g.PopulateInternalCellsFlat()
+	return g
+}
+
+// advance lets every active player choose an action with its AI and processes the round.
+// Players without an AI keep their course. An AI which does not answer is treated like a timeout on the server.
+// Running is set to false if at most one player is left.
+func (g *Game) advance() {
+	g.playerAnswer = make([]string, len(g.Players))
+	for i := range g.playerAnswer {
+		p := g.Players[i+1]
+		if !p.Active {
+			continue
+		}
+		if p.ai == nil {
+			g.playerAnswer[i] = ActionNOOP
+			continue
+		}
+		answer := make(chan string, 1)
+		ng := g.PublicCopy()
+		ng.You = i + 1
+		p.ai.GetChannel(answer)
+		p.ai.GetState(ng)
+		select {
+		case a := <-answer:
+			g.playerAnswer[i] = a
+		default:
+		}
+	}
+	g.processRound()
+	g.playerAnswer = nil
+
+	if g.checkEndGame() {
+		g.Running = false
+	}
+}
@@ -19,100 +19,92 @@
 package main
 
 import (
-	"context"
-	"encoding/json"
-	"flag"
 	"fmt"
 	"log"
 	"math/rand"
-	"net/http"
-	"net/url"
 	"os"
-	"runtime"
 	"runtime/pprof"
-	"sort"
 	"strings"
 	"time"
-
-	"github.com/gorilla/websocket"
 )
 
 // GameData holds the metadata of a round.
 type GameData struct {
 	Alive   bool
-	Collect map[string]struct {
-		Run               int
-		Won               int
-		Survived          int
-		SurvivdedOpponent int
-		Round             int
-		SurvivedList      []uint16
-		LongestOpponent   int
-	}
+	Collect map[string]ActionData
+	Safety  map[string]Safety // Classification of the first step of each action
+	Heatmap *Heatmap          // Only recorded if enabled
 
 	LongestWin       int
 	LongestWinAction string
 	Longest          int
 	LongestAction    string
 
-	Action string
-	Reason string
+	Action    string
+	Reason    string
+	Ties      []string // Actions which can not be told apart statistically from Action
+	EarlyStop bool     // The simulations stopped early since one action dominated
+	Pondered  int
+
+	Opponents []OpponentData
+	Territory int // Number of free cells the own player reaches first
+
+	Endgame *EndgameData // Result of the endgame search if it selected the action
+
+	Deadline time.Time     // Deadline used for the decision including the maximal duration
+	Thinking time.Duration // Time between receiving the state and sending the action
 
 	Game    *Game
 	Round   int
 	Jumps   int
 	Runtime time.Duration
+	Config  string // Hash of the configuration, see Config.Hash
+}
+
+// commands holds all subcommands of sl_ow. If the first argument names a command, the command is run instead of a game.
+var commands = map[string]func(args []string){
+	"analyze":  analyzeCommand,
+	"bench":    benchCommand,
+	"config":   configCommand,
+	"corpus":   corpusCommand,
+	"profiles": profilesCommand,
+	"record":   recordCommand,
+	"replay":   replayCommand,
+	"serve":    serveCommand,
+	"stats":    statsCommand,
+	"train":    trainCommand,
+	"tune":     tuneCommand,
+	"worker":   workerCommand,
 }
 
 func main() {
 	rand.Seed(time.Now().UnixNano())
 
-	endpoint := flag.String("api", "wss://msoll.de/spe_ed", "API Endpoint")
-	key := flag.String("key", "KEY", "API key")
-	quiet := flag.Bool("quiet", false, "Only print result")
-	maxDurationString := flag.String("max", "", "Max computation time in seconds. 0 or empty string disables max time. Must be parseable as time.Duration")
-	profile := flag.String("profile", "", "Profile program to file")
-	print := flag.String("print", "", "Prints output into file")
-	showui := flag.Bool("ui", false, "Enables cmd ui")
-	dump := flag.String("dump", "", "Dumps game data as gob to file")
-	printWin := flag.String("printwin", "", "Prints outcome of the game as a simple \"Win/Loss\" into file")
-	flag.Parse()
-
-	// Replace flags
-	{
-		env := os.Getenv("URL")
-		if env != "" {
-			fmt.Println("Using URL from env:", env)
-			*endpoint = env
-		}
-
-		env = os.Getenv("KEY")
-		if env != "" {
-			fmt.Println("Using KEY from env:", env)
-			*key = env
+	if len(os.Args) > 1 {
+		if c, ok := commands[os.Args[1]]; ok {
+			c(os.Args[2:])
+			return
 		}
 	}
 
-	// Max Duration
-	var maxDuration time.Duration
-	if *maxDurationString != "" {
-		var err error
-		maxDuration, err = time.ParseDuration(*maxDurationString)
-		if err != nil {
-			panic(err)
-		}
-		if maxDuration != 0 && maxDuration < 500*time.Millisecond {
-			panic(fmt.Errorf("max must be at least 500ms (is %s) or else simulations can not run", maxDuration.String()))
-		}
+	config, err := parseConfig(os.Args[0], os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
 	var UI UI
-	if *quiet {
+	var input chan string
+	switch {
+	case config.UI.Play:
+		input = make(chan string, 1)
+		UI = &terminalUI{Input: input}
+	case config.UI.Mode == "quiet":
 		UI = quietUI{}
-	} else if *showui {
+	case config.UI.Mode == "terminal":
 		UI = new(terminalUI)
-	} else {
-		UI = cmdUI{}
+	default:
+		UI = cmdUI{progress: isTerminal(os.Stdout)}
 	}
 
 	defer func() {
@@ -127,8 +119,8 @@ func main() {
 		}
 	}()
 
-	if *profile != "" {
-		f, err := os.Create(*profile)
+	if config.Profile != "" {
+		f, err := os.Create(config.Profile)
 		if err != nil {
 			log.Panicln(err)
 		}
@@ -140,260 +132,42 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
-	if *print != "" {
-		UI = &teeUI{File: *print, UI: UI}
+	if len(config.Sessions) > 0 {
+		runSessions(config)
+		return
 	}
 
-	if *dump != "" {
-		UI = &dumpUI{File: *dump, UI: UI}
-	}
+	UI = wrapUI(config, UI)
+	runSession(config, UI, input, nil)
+}
 
-	if *printWin != "" {
-		UI = &printWinUI{File: *printWin, UI: UI}
+// wrapUI adds all outputs configured in config to UI.
+func wrapUI(config Config, UI UI) UI {
+	if config.UI.Print != "" {
+		UI = &teeUI{File: config.UI.Print, UI: UI, Header: config.JSON()}
 	}
 
-	url := fmt.Sprintf("%s?key=%s", *endpoint, url.QueryEscape(*key))
-
-	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{})
-	if err != nil {
-		log.Panicln(err)
+	if config.UI.Dump != "" {
+		UI = &dumpUI{File: config.UI.Dump, UI: UI}
 	}
 
-	err = UI.Initialise()
-	if err != nil {
-		panic(err)
+	if config.UI.Record != "" {
+		UI = &recordUI{File: config.UI.Record, UI: UI}
 	}
 
-	var mastergame *Game
-	round := 0
-	lastAlive := 0
-	numberWorker := runtime.NumCPU()
-	jumpsObserved := 0
-	var start time.Time
-
-	for {
-		round++
-		_, b, err := conn.ReadMessage()
-		if err != nil {
-			log.Panicln(err)
-		}
-		if start.IsZero() {
-			start = time.Now()
-		}
-		mastergame = new(Game)
-		err = json.Unmarshal(b, mastergame)
-		if err != nil {
-			log.Panicln(err)
-		}
-		// Add round since that is not transmitted
-		for k := range mastergame.Players {
-			mastergame.Players[k].stepCounter = round - 1
-		}
-
-		if mastergame.Running == false || !mastergame.Players[mastergame.You].Active {
-			UI.NewData(GameData{
-				Alive: mastergame.Players[mastergame.You].Active,
-				Collect: make(map[string]struct {
-					Run               int
-					Won               int
-					Survived          int
-					SurvivdedOpponent int
-					Round             int
-					SurvivedList      []uint16
-					LongestOpponent   int
-				}),
-				LongestWin:       0,
-				LongestWinAction: "",
-				Longest:          0,
-				LongestAction:    "",
-				Action:           "nothing",
-				Reason:           "",
-				Round:            round,
-				Game:             mastergame,
-				Jumps:            jumpsObserved,
-				Runtime:          time.Now().Sub(start),
-			})
-		}
-
-		if mastergame.Running == false {
-			break
-		}
-
-		mastergame.PopulateInternalCellsFlat()
-
-		UI.NewRound(mastergame.PublicCopy(), round)
-
-		if !mastergame.Players[mastergame.You].Active {
-			continue
-		}
-
-		lastAlive = round
-
-		deadline, err := time.Parse(time.RFC3339, mastergame.Deadline)
-		if err != nil {
-			log.Panicln(err)
-		}
-		if maxDuration > 0 {
-			test := time.Now().Add(maxDuration)
-			if test.Before(deadline) {
-				deadline = test
-			}
-		}
-		ctxWorker, ctxWorkerCancel := context.WithDeadline(context.Background(), deadline.Add(-500*time.Millisecond))
-		ctxMain, ctxMainCancel := context.WithDeadline(context.Background(), deadline.Add(-250*time.Millisecond))
-
-		results := make(chan struct {
-			action            string
-			win               bool
-			survived          int
-			survivdedOpponent int
-			round             int
-		}, numberWorker)
-
-		data := GameData{
-			Alive: true,
-			Collect: make(map[string]struct {
-				Run               int
-				Won               int
-				Survived          int
-				SurvivdedOpponent int
-				Round             int
-				SurvivedList      []uint16
-				LongestOpponent   int
-			}),
-			LongestWin:       0,
-			LongestWinAction: "",
-			Longest:          0,
-			LongestAction:    "",
-			Action:           "nothing",
-			Reason:           "",
-			Round:            round,
-			Game:             mastergame,
-		}
-
-		for i := 0; i < numberWorker; i++ {
-			go func() {
-				for {
-					select {
-					case <-ctxWorker.Done():
-						return
-					default:
-						g := mastergame.PublicCopy()
-						test := []string{ActionTurnLeft, ActionTurnRight, ActionSlower, ActionFaster, ActionNOOP}[rand.Intn(5)]
-						g.SimulateGame(test, results)
-					}
-				}
-			}()
-		}
-
-	collectorWorker:
-		for {
-			select {
-			case r := <-results:
-				d := data.Collect[r.action]
-				d.Run++
-				if r.win {
-					d.Won++
-					if r.survived > data.LongestWin {
-						data.LongestWin = r.survived
-						data.LongestWinAction = r.action
-					}
-				}
-				if r.survived > data.Longest {
-					data.Longest = r.survived
-					data.LongestAction = r.action
-				}
-				if r.survivdedOpponent > d.LongestOpponent {
-					d.LongestOpponent = r.survivdedOpponent
-				}
-				d.Survived += r.survived
-				d.SurvivdedOpponent += r.survivdedOpponent
-				d.Round += r.round
-				d.SurvivedList = append(d.SurvivedList, uint16(r.survived))
-				data.Collect[r.action] = d
-			case <-ctxMain.Done():
-				break collectorWorker
-			}
-		}
-
-		ctxWorkerCancel()
-		ctxMainCancel()
-
-		// Sort survivedList
-		for k := range data.Collect {
-			d := data.Collect[k]
-			sort.Slice(d.SurvivedList, func(i, j int) bool { return i < j })
-			data.Collect[k] = d
-		}
-
-		best := 0.0
-
-		if data.Action == "nothing" {
-			for k := range data.Collect {
-				d := data.Collect[k]
-				if d.Run == 0 {
-					continue
-				}
-				winchance := float64(d.Won) / float64(d.Run)
-				if winchance > 0.85 && winchance > best {
-					data.Reason = "win > 85%"
-					data.Action = k
-					best = winchance
-				}
-			}
-		}
-
-		best = 0.0
-
-		if data.Action == "nothing" {
-			for k := range data.Collect {
-				d := data.Collect[k]
-				if d.Run == 0 {
-					continue
-				}
-				averageLength := float64(d.Survived) / float64(d.Run)
-				if averageLength > best && float64(d.Won)/float64(d.Run) > 0.1 {
-					best = averageLength
-					data.Action = k
-					data.Reason = "average length"
-				}
-			}
-		}
-
-		if data.Action == "nothing" {
-			// In case no win path is found
-			if data.LongestAction != "" {
-				data.Action = data.LongestAction
-				data.Reason = "longest path"
-			}
-		}
-
-		if data.Action == "nothing" {
-			data.Action = ActionNOOP
-			data.Reason = "fallback"
-		}
-
-		answer, err := json.Marshal(Action{data.Action})
-		if err != nil {
-			log.Panicln(err)
-		}
-		err = conn.WriteMessage(websocket.TextMessage, answer)
-		if err != nil {
-			log.Panicln(err)
-		}
-
-		if isJump(mastergame.PublicCopy(), data.Action) {
-			jumpsObserved++
-		}
+	if config.UI.PrintWin != "" {
+		UI = &printWinUI{File: config.UI.PrintWin, UI: UI}
+	}
 
-		data.Jumps = jumpsObserved
-		data.Runtime = time.Now().Sub(start)
+	if config.UI.Log != "" {
+		UI = &logUI{File: config.UI.Log, UI: UI}
+	}
 
-		UI.NewData(data)
+	if config.UI.History != "" {
+		UI = &historyUI{File: config.UI.History, Endpoint: config.Endpoint, UI: UI}
 	}
 
-	UI.Finish(mastergame.Players[mastergame.You].Active, lastAlive, round)
-	UI.Wait()
+	return UI
 }
 
 func (g Game) String() string {
@@ -406,7 +180,7 @@ func (g Game) PrintGame(colour bool) string {
 	for y := 0; y < g.Height; y++ {
 		for x := 0; x < g.Width; x++ {
 			v := int(g.Cells[y][x])
-			r := rune(48 + v)
+			r := playerRune(v)
 			switch {
 			case v == 0:
 				r = '·'
@@ -443,7 +217,7 @@ func (g Game) PrintGame(colour bool) string {
 				r = '×'
 			}
 			if colour && g.Cells[y][x] != -1 {
-				s.WriteString(colours[g.Cells[y][x]])
+				s.WriteString(playerColour(v))
 			}
 			s.WriteRune(r)
 			if colour {
@@ -460,7 +234,7 @@ func (g Game) PrintGame(colour bool) string {
 
 func isJump(g *Game, action string) bool {
 	// Not a jump round? Too slow?
-	if (g.Players[g.You].stepCounter+1)%HolesEachStep != 0 {
+	if (g.Players[g.You].stepCounter+1)%g.rules().HolesEachStep != 0 {
 		return false
 	}
 
@@ -490,7 +264,7 @@ func isJump(g *Game, action string) bool {
 		}
 	case ActionFaster:
 		g.Players[g.You].Speed++
-		if g.Players[g.You].Speed > MaxSpeed {
+		if g.Players[g.You].Speed > g.rules().MaxSpeed {
 			return false
 		}
 	case ActionSlower:
@@ -505,7 +279,7 @@ func isJump(g *Game, action string) bool {
 		return false
 	}
 
-	if g.Players[g.You].Speed < HoleSpeed {
+	if g.Players[g.You].Speed < g.rules().HoleSpeed {
 		return false
 	}
 
@@ -0,0 +1,261 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// OpponentHistory is the number of inferred actions kept per opponent.
+const OpponentHistory = 5
+
+// OpponentData holds the observed information of an opponent in a round.
+type OpponentData struct {
+	ID        int
+	Name      string
+	Active    bool
+	Speed     int
+	Direction string
+	Territory int      // Number of free cells the opponent reaches before all other players
+	Distance  int      // Manhattan distance to the own player
+	Actions   []string // Inferred actions of the last rounds, oldest first
+	Jumps     int      // Observed jumps
+}
+
+// opponentTracker infers the actions of all opponents by comparing consecutive game states.
+// It also records a profile of every named opponent (see OpponentProfile).
+type opponentTracker struct {
+	last     *Game
+	actions  map[int][]string
+	jumps    map[int]int
+	observed map[int]*OpponentProfile
+}
+
+// newOpponentTracker returns an empty tracker.
+func newOpponentTracker() *opponentTracker {
+	return &opponentTracker{
+		actions:  make(map[int][]string),
+		jumps:    make(map[int]int),
+		observed: make(map[int]*OpponentProfile),
+	}
+}
+
+// update adds the game state of the next round and returns the data of all opponents sorted by id and the own territory.
+func (t *opponentTracker) update(g *Game) ([]OpponentData, int) {
+	for i, p := range g.Players {
+		if _, ok := t.observed[i]; !ok && i != g.You && p.Name != "" {
+			t.observed[i] = newOpponentProfile(p.Name)
+			t.observed[i].Games = 1
+		}
+	}
+	if t.last != nil {
+		for i, p := range g.Players {
+			old, ok := t.last.Players[i]
+			if !ok || !old.Active {
+				continue
+			}
+			profile := t.observed[i]
+			if !p.Active {
+				if profile != nil {
+					profile.Crashes++
+					if p.stepCounter <= ProfileEarlyRounds {
+						profile.EarlyCrashes++
+					}
+				}
+				continue
+			}
+			action := inferAction(old, p)
+			t.actions[i] = append(t.actions[i], action)
+			if len(t.actions[i]) > OpponentHistory {
+				t.actions[i] = t.actions[i][len(t.actions[i])-OpponentHistory:]
+			}
+			jumped := t.last.jumped(old, p)
+			if jumped {
+				t.jumps[i]++
+			}
+			if profile != nil {
+				profile.addAction(old.Speed, action)
+				if jumped {
+					profile.Jumps++
+				}
+			}
+		}
+	}
+	t.last = g.PublicCopy()
+
+	territory := g.territory()
+	result := make([]OpponentData, 0, len(g.Players))
+	you := g.Players[g.You]
+	for i, p := range g.Players {
+		if i == g.You {
+			continue
+		}
+		d := OpponentData{
+			ID:        i,
+			Name:      p.Name,
+			Active:    p.Active,
+			Speed:     p.Speed,
+			Direction: p.Direction,
+			Territory: territory[i],
+			Actions:   append([]string(nil), t.actions[i]...),
+			Jumps:     t.jumps[i],
+		}
+		if you != nil {
+			d.Distance = abs(p.X-you.X) + abs(p.Y-you.Y)
+		}
+		result = append(result, d)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, territory[g.You]
+}
+
+// profiles returns the profiles observed so far by name.
+func (t *opponentTracker) profiles() map[string]*OpponentProfile {
+	result := make(map[string]*OpponentProfile, len(t.observed))
+	now := time.Now()
+	for _, o := range t.observed {
+		p, ok := result[o.Name]
+		if !ok {
+			p = newOpponentProfile(o.Name)
+			p.Updated = now
+			result[o.Name] = p
+		}
+		p.merge(o)
+	}
+	return result
+}
+
+// inferAction returns the action which changed the player from old to new.
+func inferAction(old, new *Player) string {
+	switch {
+	case new.Speed == old.Speed+1:
+		return ActionFaster
+	case new.Speed == old.Speed-1:
+		return ActionSlower
+	case new.Direction == old.Direction:
+		return ActionNOOP
+	}
+	switch old.Direction {
+	case DirectionUp:
+		if new.Direction == DirectionLeft {
+			return ActionTurnLeft
+		}
+	case DirectionDown:
+		if new.Direction == DirectionRight {
+			return ActionTurnLeft
+		}
+	case DirectionLeft:
+		if new.Direction == DirectionDown {
+			return ActionTurnLeft
+		}
+	case DirectionRight:
+		if new.Direction == DirectionUp {
+			return ActionTurnLeft
+		}
+	}
+	return ActionTurnRight
+}
+
+// jumped returns whether the move of a player from old to new in the following round jumped over an occupied cell of g.
+// new must contain the step counter of the round after the move.
+func (g *Game) jumped(old, new *Player) bool {
+	if new.Speed < g.rules().HoleSpeed || new.stepCounter%g.rules().HolesEachStep != 0 {
+		return false
+	}
+	dx, dy := 0, 0
+	switch new.Direction {
+	case DirectionUp:
+		dy = -1
+	case DirectionDown:
+		dy = 1
+	case DirectionLeft:
+		dx = -1
+	case DirectionRight:
+		dx = 1
+	}
+	for s := 1; s < new.Speed-1; s++ {
+		x, y := old.X+(s+1)*dx, old.Y+(s+1)*dy
+		if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
+			return false
+		}
+		if g.Cells[y][x] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// territory returns for each active player the number of free cells which the player reaches strictly before all other players.
+// Distances are measured in steps through free cells ignoring speed.
+func (g *Game) territory() map[int]int {
+	owner := make([]int, g.Width*g.Height) // 0 unknown, -1 contested
+	distance := make([]int, g.Width*g.Height)
+	queue := make([]int, 0, g.Width*g.Height)
+
+	ids := make([]int, 0, len(g.Players))
+	for i := range g.Players {
+		ids = append(ids, i)
+	}
+	sort.Ints(ids)
+	for _, i := range ids {
+		p := g.Players[i]
+		if !p.Active || p.X < 0 || p.X >= g.Width || p.Y < 0 || p.Y >= g.Height {
+			continue
+		}
+		c := p.Y*g.Width + p.X
+		if owner[c] != 0 {
+			owner[c] = -1
+			continue
+		}
+		owner[c] = i
+		queue = append(queue, c)
+	}
+
+	result := make(map[int]int, len(g.Players))
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		x, y := c%g.Width, c/g.Width
+		for _, n := range [4][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+			if n[0] < 0 || n[0] >= g.Width || n[1] < 0 || n[1] >= g.Height || g.Cells[n[1]][n[0]] != 0 {
+				continue
+			}
+			nc := n[1]*g.Width + n[0]
+			switch {
+			case owner[nc] == 0:
+				owner[nc] = owner[c]
+				distance[nc] = distance[c] + 1
+				queue = append(queue, nc)
+				if owner[c] > 0 {
+					result[owner[c]]++
+				}
+			case owner[nc] > 0 && owner[nc] != owner[c] && distance[nc] == distance[c]+1:
+				// Reached at the same time by two players
+				result[owner[nc]]--
+				owner[nc] = -1
+			}
+		}
+	}
+	return result
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
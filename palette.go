@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/gdamore/tcell"
+)
+
+// MaxPlayers is the highest player id which can be stored in a cell.
+const MaxPlayers = math.MaxInt8
+
+var colours = []string{"\033[39m", "\033[31m", "\033[32m", "\033[33m", "\033[34m", "\033[35m", "\033[36m"}
+var colourReset = "\033[0m"
+
+// playerRGB holds the colours of the first players. Colours of further players are generated.
+var playerRGB = [][3]int32{
+	{178, 24, 24},
+	{24, 178, 24},
+	{178, 104, 24},
+	{24, 24, 178},
+	{178, 24, 178},
+	{24, 178, 178},
+}
+
+// playerColourRGB returns the colour of a player (id > 0).
+// Further colours are spread over the hue circle using the golden angle, so neighbouring ids get distinct colours.
+func playerColourRGB(id int) (r, g, b int32) {
+	if id <= len(playerRGB) {
+		c := playerRGB[id-1]
+		return c[0], c[1], c[2]
+	}
+	h := math.Mod(float64(id-len(playerRGB))*137.508, 360)
+	s, v := 0.85, 0.75
+	if id%2 == 0 {
+		v = 0.55
+	}
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := v - c
+	var rf, gf, bf float64
+	switch {
+	case h < 60:
+		rf, gf, bf = c, x, 0
+	case h < 120:
+		rf, gf, bf = x, c, 0
+	case h < 180:
+		rf, gf, bf = 0, c, x
+	case h < 240:
+		rf, gf, bf = 0, x, c
+	case h < 300:
+		rf, gf, bf = x, 0, c
+	default:
+		rf, gf, bf = c, 0, x
+	}
+	return int32((rf + m) * 255), int32((gf + m) * 255), int32((bf + m) * 255)
+}
+
+// playerColour returns the ANSI escape sequence of the colour of a player (0 for the default colour).
+// Players beyond the standard colours use the 256 colour palette.
+func playerColour(id int) string {
+	if id >= 0 && id < len(colours) {
+		return colours[id]
+	}
+	if id < 0 {
+		return colours[0]
+	}
+	r, g, b := playerColourRGB(id)
+	return fmt.Sprintf("\033[38;5;%dm", 16+36*(r*6/256)+6*(g*6/256)+b*6/256)
+}
+
+// playerTerminalColour returns the colour of a cell value in the terminal ui.
+func playerTerminalColour(v int) tcell.Color {
+	if v <= 0 {
+		return tcell.ColorBlack
+	}
+	return tcell.NewRGBColor(playerColourRGB(v))
+}
+
+// playerRune returns the character of a player (id > 0) in the textual board: 1-9, then A-Z, then further letters.
+func playerRune(id int) rune {
+	switch {
+	case id < 10:
+		return rune('0' + id)
+	case id < 36:
+		return rune('A' + id - 10)
+	default:
+		return rune(0x100 + id - 36)
+	}
+}
+
+// playerFromRune is the inverse of playerRune. It returns 0 if r is not the character of a player.
+func playerFromRune(r rune) int {
+	switch {
+	case r >= '1' && r <= '9':
+		return int(r - '0')
+	case r >= 'A' && r <= 'Z':
+		return int(r-'A') + 10
+	case r >= 0x100 && r < 0x100+MaxPlayers-35:
+		return int(r-0x100) + 36
+	}
+	return 0
+}
+
+// playerIDs returns the ids of all players sorted.
+func (g *Game) playerIDs() []int {
+	ids := make([]int, 0, len(g.Players))
+	for k := range g.Players {
+		ids = append(ids, k)
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Parameters holds the tunable parameters of the decision policy and the AIs.
+type Parameters struct {
+	// WinThreshold is the win chance above which an action is selected directly.
+	WinThreshold float64 `json:"winThreshold"`
+	// WinGate is the minimal win chance of an action to be selected by its average length.
+	WinGate float64 `json:"winGate"`
+	// JumpAITries contains the number of iterations JumpAI uses to find a jump.
+	JumpAITries int `json:"jumpAITries"`
+	// JumpingLargestFreeAIJumpAtLessThanFree is the number of free cells connected at which JumpingLargestFreeAI tries to jump.
+	JumpingLargestFreeAIJumpAtLessThanFree int `json:"jumpingLargestFreeAIJumpAtLessThanFree"`
+	// MetaAISwitchProbability is the probability that MetaAI selects a new AI each round.
+	MetaAISwitchProbability float64 `json:"metaAISwitchProbability"`
+	// Exploration is the exploration constant of the UCB1 selection of the first action in the simulations.
+	Exploration float64 `json:"exploration"`
+	// EarlyStopRuns is the number of simulations the best action needs before the engine may stop early because it dominates all other actions.
+	// 0 disables early stopping.
+	EarlyStopRuns int `json:"earlyStopRuns"`
+	// EndgameDepth is the maximal depth in rounds of the search which replaces the simulations if only one opponent is left and the position is not lost. 0 disables the search.
+	EndgameDepth int `json:"endgameDepth"`
+	// LearnedModel is the model of LearnedAI (see 'sl_ow train'). DefaultLearnedModel is used if empty.
+	LearnedModel *LearnedModel `json:"learnedModel,omitempty"`
+}
+
+// DefaultParameters holds the parameters used if nothing else is configured.
+var DefaultParameters = Parameters{
+	WinThreshold:                           0.85,
+	WinGate:                                0.1,
+	JumpAITries:                            100,
+	JumpingLargestFreeAIJumpAtLessThanFree: 50,
+	MetaAISwitchProbability:                0.1,
+	Exploration:                            0.7,
+	EarlyStopRuns:                          500,
+	EndgameDepth:                           3,
+}
+
+// Validate returns an error if the parameters are out of range.
+func (p Parameters) Validate() error {
+	if p.WinThreshold < 0 || p.WinThreshold > 1 {
+		return fmt.Errorf("winThreshold must be between 0 and 1 (is %f)", p.WinThreshold)
+	}
+	if p.WinGate < 0 || p.WinGate > 1 {
+		return fmt.Errorf("winGate must be between 0 and 1 (is %f)", p.WinGate)
+	}
+	if p.JumpAITries < 1 {
+		return fmt.Errorf("jumpAITries must be at least 1 (is %d)", p.JumpAITries)
+	}
+	if p.JumpingLargestFreeAIJumpAtLessThanFree < 0 {
+		return fmt.Errorf("jumpingLargestFreeAIJumpAtLessThanFree must not be negative (is %d)", p.JumpingLargestFreeAIJumpAtLessThanFree)
+	}
+	if p.MetaAISwitchProbability < 0 || p.MetaAISwitchProbability > 1 {
+		return fmt.Errorf("metaAISwitchProbability must be between 0 and 1 (is %f)", p.MetaAISwitchProbability)
+	}
+	if p.Exploration < 0 {
+		return fmt.Errorf("exploration must not be negative (is %f)", p.Exploration)
+	}
+	if p.EarlyStopRuns < 0 {
+		return fmt.Errorf("earlyStopRuns must not be negative (is %d)", p.EarlyStopRuns)
+	}
+	if p.EndgameDepth < 0 {
+		return fmt.Errorf("endgameDepth must not be negative (is %d)", p.EndgameDepth)
+	}
+	if p.LearnedModel != nil {
+		err := p.LearnedModel.Validate()
+		if err != nil {
+			return fmt.Errorf("learnedModel: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadParameters reads parameters from a JSON file.
+// Missing values are taken from DefaultParameters.
+func loadParameters(file string) (Parameters, error) {
+	p := DefaultParameters
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return p, err
+	}
+	err = json.Unmarshal(b, &p)
+	if err != nil {
+		return p, err
+	}
+	return p, p.Validate()
+}
+
+// saveParameters writes the parameters as JSON to a file.
+func saveParameters(file string, p Parameters) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(b, '\n'), 0644)
+}
+
+// params returns the parameters of the game or DefaultParameters if none are set.
+func (g *Game) params() *Parameters {
+	if g.parameters == nil {
+		return &DefaultParameters
+	}
+	return g.parameters
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// PlayDefaultEngine selects the action of the engine if the human player does not select an action in time.
+const PlayDefaultEngine = "engine"
+
+// awaitHuman collects the actions of the human player until ctx is done, so that the choice can be changed until the deadline.
+// Inputs given before the call are dropped.
+// The returned channel receives the last action once ctx is done or an empty string if no action was selected.
+func awaitHuman(ctx context.Context, input <-chan string) <-chan string {
+	// Drop inputs of earlier rounds
+drain:
+	for {
+		select {
+		case <-input:
+		default:
+			break drain
+		}
+	}
+
+	result := make(chan string, 1)
+	go func() {
+		last := ""
+		for {
+			select {
+			case last = <-input:
+			case <-ctx.Done():
+				result <- last
+				return
+			}
+		}
+	}()
+	return result
+}
+
+// sendLatest sends v to c. If c is full, the oldest values are dropped so that the latest input is never lost.
+func sendLatest(c chan string, v string) {
+	for {
+		select {
+		case c <- v:
+			return
+		default:
+		}
+		select {
+		case <-c:
+		default:
+		}
+	}
+}
+
+// buildHintString returns the hint of the engine for the human player.
+func buildHintString(p ProgressData) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("hint: %s |", p.Leader))
+	for _, action := range []string{ActionNOOP, ActionSlower, ActionFaster, ActionTurnLeft, ActionTurnRight} {
+		if w, ok := p.WinChances[action]; ok {
+			sb.WriteString(fmt.Sprintf(" %s %.2f", action, w))
+		} else {
+			sb.WriteString(fmt.Sprintf(" %s -", action))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSendLatest(t *testing.T) {
+	input := make(chan string, 1)
+	for _, a := range []string{ActionTurnLeft, ActionFaster, ActionTurnRight} {
+		sendLatest(input, a)
+	}
+	if a := <-input; a != ActionTurnRight {
+		t.Errorf("received %s, want %s", a, ActionTurnRight)
+	}
+
+	// The last key of a round is the answer
+	ctx, cancel := context.WithCancel(context.Background())
+	result := awaitHuman(ctx, input)
+	for _, a := range []string{ActionSlower, ActionNOOP, ActionTurnLeft} {
+		sendLatest(input, a)
+	}
+	for len(input) > 0 {
+		// Wait until awaitHuman has read all keys
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if a := <-result; a != ActionTurnLeft {
+		t.Errorf("answer %s, want %s", a, ActionTurnLeft)
+	}
+}
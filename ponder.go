@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+const (
+	// PonderSamples is the number of sampled opponent replies used to find likely next states.
+	PonderSamples = 200
+	// PonderCandidates is the maximum number of next states simulated while pondering.
+	PonderCandidates = 8
+)
+
+type ponderCandidate struct {
+	l sync.Mutex
+
+	key     uint64
+	game    *Game
+	weight  int
+	data    GameData
+	sampler *rootSampler
+}
+
+// ponderer simulates likely next states while waiting for the server.
+type ponderer struct {
+	candidates []*ponderCandidate
+	cancel     context.CancelFunc
+	done       <-chan struct{} // Closed after all workers are finished, nil if nothing is simulated
+}
+
+// startPondering starts simulating the likely next states of g given our committed action.
+// round is the round number of the next state.
+// The returned ponderer must be stopped before the results can be used.
+func (e *Engine) startPondering(g *Game, action string, round int) *ponderer {
+	p := &ponderer{}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	// Sample opponent replies
+	seen := make(map[uint64]*ponderCandidate)
+	source := e.workerRandom(round, randomPonder)
+	for i := 0; i < PonderSamples; i++ {
+		ng := g.PublicCopy()
+		ng.playerAnswer = make([]string, len(ng.Players))
+		for k := range ng.playerAnswer {
+			if k+1 == ng.You {
+				ng.playerAnswer[k] = action
+				continue
+			}
+			if ng.Players[k+1].Active {
+				// Same as the first round of SimulateGame
+				answer := make(chan string, 1)
+				og := ng.PublicCopy()
+				og.You = k + 1
+				og.source = source
+				ai := BadRandomAI{}
+				ai.GetChannel(answer)
+				ai.GetState(og)
+				ng.playerAnswer[k] = <-answer
+			}
+		}
+		ng.processRound()
+		ng.playerAnswer = nil
+
+		if !ng.Players[ng.You].Active || ng.checkEndGame() {
+			// Nothing to simulate
+			continue
+		}
+
+		key := ng.stateKey()
+		c, ok := seen[key]
+		if !ok {
+			c = &ponderCandidate{key: key, game: ng, data: newGameData(ng, round), sampler: newRootSampler(ng, e.params().Exploration)}
+			seen[key] = c
+			p.candidates = append(p.candidates, c)
+		}
+		c.weight++
+	}
+
+	sort.Slice(p.candidates, func(i, j int) bool { return p.candidates[i].weight > p.candidates[j].weight })
+	if len(p.candidates) > PonderCandidates {
+		p.candidates = p.candidates[:PonderCandidates]
+	}
+	if len(p.candidates) == 0 {
+		return p
+	}
+
+	totalWeight := 0
+	for i := range p.candidates {
+		totalWeight += p.candidates[i].weight
+	}
+	sources := make([]randomSource, e.workerCount())
+	for i := range sources {
+		sources[i] = e.workerRandom(round, randomPonder-1-i)
+	}
+
+	step := func(worker int) {
+		results := make(chan struct {
+			action            string
+			win               bool
+			survived          int
+			survivdedOpponent int
+			round             int
+		}, 1)
+
+		// Pick candidate by weight
+		w := sources[worker].Intn(totalWeight)
+		c := p.candidates[0]
+		for i := range p.candidates {
+			w -= p.candidates[i].weight
+			if w < 0 {
+				c = p.candidates[i]
+				break
+			}
+		}
+
+		ng := c.game.PublicCopy()
+		ng.rollout = aiConstructors[e.Rollout]
+		ng.parameters = e.Parameters
+		ng.profiles = e.Profiles
+		ng.source = sources[worker]
+		a := c.sampler.next()
+		ng.SimulateGame(c.sampler.actions[a], results)
+		r := <-results
+		c.sampler.update(a, r.win, r.survived)
+		c.l.Lock()
+		c.data.collect(r)
+		c.l.Unlock()
+	}
+	p.done = e.run(ctx, step)
+
+	return p
+}
+
+// stop stops pondering and waits until all workers are finished.
+// It is safe to call stop on a nil ponderer.
+func (p *ponderer) stop() {
+	if p == nil {
+		return
+	}
+	p.cancel()
+	if p.done != nil {
+		<-p.done
+	}
+}
+
+// lookup returns the pondered data for g if g was one of the simulated states.
+// Must only be called after stop.
+func (p *ponderer) lookup(g *Game) (GameData, bool) {
+	if p == nil {
+		return GameData{}, false
+	}
+	key := g.stateKey()
+	for i := range p.candidates {
+		if p.candidates[i].key == key && p.candidates[i].game.sameState(g) {
+			return p.candidates[i].data, true
+		}
+	}
+	return GameData{}, false
+}
+
+// stateKey returns a hash of the cells and the public player state.
+// Position, speed and direction are only included for active players since the server and the local simulation might place dead players differently.
+func (g *Game) stateKey() uint64 {
+	h := fnv.New64a()
+	b := make([]byte, 8)
+	for y := range g.Cells {
+		for x := range g.Cells[y] {
+			h.Write([]byte{byte(g.Cells[y][x])})
+		}
+	}
+	for i := 1; i <= len(g.Players); i++ {
+		p := g.Players[i]
+		if p == nil {
+			continue
+		}
+		if !p.Active {
+			h.Write([]byte{0})
+			continue
+		}
+		h.Write([]byte{1})
+		binary.LittleEndian.PutUint64(b, uint64(p.X)<<32|uint64(p.Y))
+		h.Write(b)
+		binary.LittleEndian.PutUint64(b, uint64(p.Speed))
+		h.Write(b)
+		h.Write([]byte(p.Direction))
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+// ponderTestGame returns a 10x10 board with three players. Player 2 at (5,5) is boxed in and dies in the next round.
+func ponderTestGame() *Game {
+	g := &Game{
+		Width:   10,
+		Height:  10,
+		Cells:   make([][]int8, 10),
+		You:     1,
+		Running: true,
+		Players: map[int]*Player{
+			1: {X: 1, Y: 1, Direction: DirectionRight, Speed: 1, Active: true, stepCounter: 5},
+			2: {X: 5, Y: 5, Direction: DirectionUp, Speed: 1, Active: true, stepCounter: 5},
+			3: {X: 8, Y: 8, Direction: DirectionUp, Speed: 1, Active: true, stepCounter: 5},
+		},
+	}
+	for y := range g.Cells {
+		g.Cells[y] = make([]int8, g.Width)
+	}
+	for y := 3; y <= 7; y++ {
+		for x := 3; x <= 7; x++ {
+			g.Cells[y][x] = 2
+		}
+	}
+	g.Cells[1][1] = 1
+	g.Cells[8][8] = 3
+	return g
+}
+
+func TestStateKey(t *testing.T) {
+	g := ponderTestGame()
+	g.Players[2].Active = false
+
+	tests := []struct {
+		name   string
+		modify func(o *Game)
+		same   bool
+	}{
+		{"copy", func(o *Game) {}, true},
+		{"dead player moved", func(o *Game) {
+			o.Players[2].X = 0
+			o.Players[2].Y = 9
+			o.Players[2].Speed = 4
+			o.Players[2].Direction = DirectionLeft
+		}, true},
+		{"position of active player", func(o *Game) { o.Players[1].X++ }, false},
+		{"speed of active player", func(o *Game) { o.Players[3].Speed++ }, false},
+		{"direction of active player", func(o *Game) { o.Players[3].Direction = DirectionLeft }, false},
+		{"player died", func(o *Game) { o.Players[3].Active = false }, false},
+		{"cells", func(o *Game) { o.Cells[0][0] = 1 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := g.PublicCopy()
+			tt.modify(o)
+			if same := g.stateKey() == o.stateKey(); same != tt.same {
+				t.Errorf("same key is %t, want %t", same, tt.same)
+			}
+		})
+	}
+}
+
+func TestPonderLookup(t *testing.T) {
+	g := ponderTestGame()
+	e := Engine{Workers: 2, Seed: 1}
+	p := e.startPondering(g, ActionNOOP, 6)
+	p.stop()
+	if len(p.candidates) == 0 {
+		t.Fatal("no candidates")
+	}
+
+	for i, c := range p.candidates {
+		if c.game.Players[2].Active {
+			t.Fatalf("candidate %d: boxed in player survived", i)
+		}
+
+		// The server might place the dead player differently
+		o := c.game.PublicCopy()
+		o.Players[2].X = 0
+		o.Players[2].Y = 0
+		o.Players[2].Speed = 1
+		data, ok := p.lookup(o)
+		if !ok {
+			t.Errorf("candidate %d not found", i)
+			continue
+		}
+		if data.Game != c.data.Game {
+			t.Errorf("candidate %d: lookup returned data of another state", i)
+		}
+	}
+
+	o := p.candidates[0].game.PublicCopy()
+	o.Players[1].Speed++
+	if _, ok := p.lookup(o); ok {
+		t.Error("state which was not pondered found")
+	}
+	if _, ok := (*ponderer)(nil).lookup(g); ok {
+		t.Error("nil ponderer found a state")
+	}
+
+	// The sampled replies only depend on the seed
+	q := e.startPondering(g, ActionNOOP, 6)
+	q.stop()
+	if len(q.candidates) != len(p.candidates) {
+		t.Fatalf("%d candidates, %d with the same seed", len(q.candidates), len(p.candidates))
+	}
+	for i := range p.candidates {
+		if p.candidates[i].key != q.candidates[i].key || p.candidates[i].weight != q.candidates[i].weight {
+			t.Errorf("candidate %d differs with the same seed", i)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WorkerPool runs the simulations of several engines on a shared set of workers.
+// Jobs with a deadline share the workers weighted by their remaining time, so that urgent jobs get more workers without starving the others.
+// Jobs without a deadline (e.g. pondering) only run if no job with a deadline is waiting.
+type WorkerPool struct {
+	l       sync.Mutex
+	cond    *sync.Cond
+	jobs    []*poolJob
+	next    int // Round robin over jobs without deadline
+	workers int
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+type poolJob struct {
+	deadline time.Time // Zero if the job has no deadline
+	step     func(worker int)
+	running  int
+	done     bool
+	finished chan struct{}
+}
+
+// NewWorkerPool returns a pool with the given number of workers.
+func NewWorkerPool(workers int) *WorkerPool {
+	p := &WorkerPool{workers: workers}
+	p.cond = sync.NewCond(&p.l)
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work(i)
+	}
+	return p
+}
+
+// Run calls step repeatedly on the workers of the pool until ctx is done. The deadline of ctx is used for scheduling.
+// step receives the number of the calling worker.
+// It does not block. The returned channel is closed after all calls of step have returned.
+func (p *WorkerPool) Run(ctx context.Context, step func(worker int)) <-chan struct{} {
+	j := &poolJob{step: step, finished: make(chan struct{})}
+	j.deadline, _ = ctx.Deadline()
+
+	p.l.Lock()
+	p.jobs = append(p.jobs, j)
+	p.l.Unlock()
+	p.cond.Broadcast()
+
+	go func() {
+		<-ctx.Done()
+		p.l.Lock()
+		defer p.l.Unlock()
+		j.done = true
+		for i := range p.jobs {
+			if p.jobs[i] == j {
+				p.jobs = append(p.jobs[:i], p.jobs[i+1:]...)
+				break
+			}
+		}
+		if j.running == 0 {
+			close(j.finished)
+		}
+	}()
+	return j.finished
+}
+
+// pick returns the job which should run next or nil if there is none. Must be called with the lock held.
+// Of the jobs with a deadline, the job with the fewest running steps relative to its urgency is picked (running steps times remaining time).
+// Every job gets a worker before any job gets a second one, ties are broken by the earliest deadline.
+func (p *WorkerPool) pick() *poolJob {
+	var best *poolJob
+	bestScore := 0.0
+	now := time.Now()
+	for _, j := range p.jobs {
+		if j.deadline.IsZero() {
+			continue
+		}
+		remaining := j.deadline.Sub(now)
+		if remaining < time.Millisecond {
+			remaining = time.Millisecond
+		}
+		score := float64(j.running) * remaining.Seconds()
+		if best == nil || score < bestScore || (score == bestScore && j.deadline.Before(best.deadline)) {
+			best = j
+			bestScore = score
+		}
+	}
+	if best != nil || len(p.jobs) == 0 {
+		return best
+	}
+	p.next = (p.next + 1) % len(p.jobs)
+	return p.jobs[p.next]
+}
+
+// Close stops all workers and waits until they have returned. Running steps are finished first.
+// Jobs started after Close never run.
+func (p *WorkerPool) Close() {
+	p.l.Lock()
+	p.closed = true
+	p.l.Unlock()
+	p.cond.Broadcast()
+	p.wg.Wait()
+}
+
+func (p *WorkerPool) work(worker int) {
+	defer p.wg.Done()
+	p.l.Lock()
+	for {
+		if p.closed {
+			p.l.Unlock()
+			return
+		}
+		j := p.pick()
+		if j == nil {
+			p.cond.Wait()
+			continue
+		}
+		j.running++
+		p.l.Unlock()
+		j.step(worker)
+		p.l.Lock()
+		j.running--
+		if j.done && j.running == 0 {
+			close(j.finished)
+		}
+	}
+}
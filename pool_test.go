@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingStep returns a step which counts its calls.
+func countingStep(n *int64) func(int) {
+	return func(int) {
+		atomic.AddInt64(n, 1)
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWorkerPool(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	p := NewWorkerPool(4)
+
+	// Jobs with a deadline share the workers by their remaining time
+	var urgent, relaxed int64
+	ctxUrgent, cancelUrgent := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancelUrgent()
+	ctxRelaxed, cancelRelaxed := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancelRelaxed()
+	doneUrgent := p.Run(ctxUrgent, countingStep(&urgent))
+	doneRelaxed := p.Run(ctxRelaxed, countingStep(&relaxed))
+
+	// Jobs without a deadline wait
+	var background int64
+	ctxBackground, cancelBackground := context.WithCancel(context.Background())
+	doneBackground := p.Run(ctxBackground, countingStep(&background))
+
+	<-doneUrgent
+	b := atomic.LoadInt64(&background)
+	cancelRelaxed()
+	<-doneRelaxed
+	u, r := atomic.LoadInt64(&urgent), atomic.LoadInt64(&relaxed)
+	if u == 0 || r == 0 {
+		t.Fatalf("steps: urgent %d, relaxed %d, want progress in both", u, r)
+	}
+	if u <= r {
+		t.Errorf("steps: urgent %d, relaxed %d, want more for the urgent job", u, r)
+	}
+	if b != 0 {
+		t.Errorf("job without deadline ran %d steps while jobs with deadline were waiting", b)
+	}
+
+	// Jobs without a deadline take turns
+	var second int64
+	ctxSecond, cancelSecond := context.WithCancel(context.Background())
+	doneSecond := p.Run(ctxSecond, countingStep(&second))
+	time.Sleep(100 * time.Millisecond)
+	cancelBackground()
+	cancelSecond()
+	<-doneBackground
+	<-doneSecond
+	if b, s := atomic.LoadInt64(&background), atomic.LoadInt64(&second); b == 0 || s == 0 {
+		t.Errorf("steps without deadline: %d and %d, want progress in both", b, s)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		p.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close does not return")
+	}
+
+	// All workers and job goroutines are gone
+	for i := 0; runtime.NumGoroutine() > goroutines; i++ {
+		if i == 100 {
+			t.Fatalf("%d goroutines left, %d before the pool", runtime.NumGoroutine(), goroutines)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
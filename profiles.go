@@ -0,0 +1,351 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// DefaultProfilesFile is the name of the opponent profiles in the user configuration directory.
+	DefaultProfilesFile = "profiles.json"
+	// ProfileEarlyRounds is the number of rounds in which a crash counts as early.
+	ProfileEarlyRounds = 30
+	// ProfileMinSamples is the number of actions which must be observed at a speed before ProfileAI imitates the opponent at that speed.
+	ProfileMinSamples = 10
+)
+
+// OpponentProfile holds the observed habits of all opponents with the same name over several games.
+type OpponentProfile struct {
+	Name         string                 `json:"name"`
+	Games        int                    `json:"games"`
+	Rounds       int                    `json:"rounds"`       // Observed moves
+	Actions      map[int]map[string]int `json:"actions"`      // Inferred actions by speed before the action
+	Jumps        int                    `json:"jumps"`        // Observed jumps
+	Crashes      int                    `json:"crashes"`      // Games in which the opponent died
+	EarlyCrashes int                    `json:"earlyCrashes"` // Games in which the opponent died in the first ProfileEarlyRounds rounds
+	Updated      time.Time              `json:"updated"`
+}
+
+// newOpponentProfile returns an empty profile.
+func newOpponentProfile(name string) *OpponentProfile {
+	return &OpponentProfile{Name: name, Actions: make(map[int]map[string]int)}
+}
+
+// addAction counts an action taken at the given speed.
+func (p *OpponentProfile) addAction(speed int, action string) {
+	if p.Actions[speed] == nil {
+		p.Actions[speed] = make(map[string]int)
+	}
+	p.Actions[speed][action]++
+	p.Rounds++
+}
+
+// merge adds all observations of o.
+func (p *OpponentProfile) merge(o *OpponentProfile) {
+	p.Games += o.Games
+	for speed := range o.Actions {
+		for a, n := range o.Actions[speed] {
+			if p.Actions[speed] == nil {
+				p.Actions[speed] = make(map[string]int)
+			}
+			p.Actions[speed][a] += n
+		}
+	}
+	p.Rounds += o.Rounds
+	p.Jumps += o.Jumps
+	p.Crashes += o.Crashes
+	p.EarlyCrashes += o.EarlyCrashes
+	if o.Updated.After(p.Updated) {
+		p.Updated = o.Updated
+	}
+}
+
+// actionCount returns the number of actions observed at the given speed.
+func (p *OpponentProfile) actionCount(speed int) int {
+	n := 0
+	for _, c := range p.Actions[speed] {
+		n += c
+	}
+	return n
+}
+
+// total returns the number of observations of an action over all speeds.
+func (p *OpponentProfile) total(action string) int {
+	n := 0
+	for speed := range p.Actions {
+		n += p.Actions[speed][action]
+	}
+	return n
+}
+
+// TurnLeftShare returns the share of left turns out of all turns or 0.5 if no turns were observed.
+func (p *OpponentProfile) TurnLeftShare() float64 {
+	left, right := p.total(ActionTurnLeft), p.total(ActionTurnRight)
+	if left+right == 0 {
+		return 0.5
+	}
+	return float64(left) / float64(left+right)
+}
+
+// EarlyCrashRate returns the share of games in which the opponent crashed early.
+func (p *OpponentProfile) EarlyCrashRate() float64 {
+	if p.Games == 0 {
+		return 0
+	}
+	return float64(p.EarlyCrashes) / float64(p.Games)
+}
+
+// ProfileStore holds the profiles of all known opponents by name.
+type ProfileStore struct {
+	Profiles map[string]*OpponentProfile `json:"profiles"`
+}
+
+// profileLock serialises updates of concurrent sessions.
+var profileLock sync.Mutex
+
+// loadProfiles reads the profiles from file. A missing file results in an empty store.
+func loadProfiles(file string) (*ProfileStore, error) {
+	s := &ProfileStore{Profiles: make(map[string]*OpponentProfile)}
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, s)
+	if err != nil {
+		return nil, fmt.Errorf("can not parse profiles %s: %w", file, err)
+	}
+	if s.Profiles == nil {
+		s.Profiles = make(map[string]*OpponentProfile)
+	}
+	for name, p := range s.Profiles {
+		p.Name = name
+		if p.Actions == nil {
+			p.Actions = make(map[int]map[string]int)
+		}
+	}
+	return s, nil
+}
+
+// save writes the store to file. The file is replaced atomically so that a crash does not lose all profiles.
+func (s *ProfileStore) save(file string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// forGame returns the profiles of all opponents in g by player id. Opponents without name or profile are left out.
+func (s *ProfileStore) forGame(g *Game) map[int]*OpponentProfile {
+	result := make(map[int]*OpponentProfile)
+	for k, p := range g.Players {
+		if k == g.You || p.Name == "" {
+			continue
+		}
+		if profile, ok := s.Profiles[p.Name]; ok {
+			result[k] = profile
+		}
+	}
+	return result
+}
+
+// updateProfiles merges the observed profiles into the profiles stored in file.
+func updateProfiles(file string, observed map[string]*OpponentProfile) error {
+	if len(observed) == 0 {
+		return nil
+	}
+
+	profileLock.Lock()
+	defer profileLock.Unlock()
+	s, err := loadProfiles(file)
+	if err != nil {
+		return err
+	}
+	for name, o := range observed {
+		p, ok := s.Profiles[name]
+		if !ok {
+			p = newOpponentProfile(name)
+			s.Profiles[name] = p
+		}
+		p.merge(o)
+	}
+	return s.save(file)
+}
+
+// ProfileAI imitates a known opponent by sampling its actions from the action frequencies of its profile at the current speed.
+// Certainly fatal actions are avoided except for the observed share of early crashes.
+// If too few actions were observed at the current speed, Fallback selects the action.
+type ProfileAI struct {
+	Profile  *OpponentProfile
+	Fallback AI
+
+	l sync.Mutex
+	i chan string
+}
+
+// GetChannel receives the answer channel.
+func (p *ProfileAI) GetChannel(c chan string) {
+	p.l.Lock()
+	defer p.l.Unlock()
+	p.i = c
+	p.Fallback.GetChannel(c)
+}
+
+// GetState gets the game state and computes an answer.
+func (p *ProfileAI) GetState(g *Game) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	if p.i == nil || !g.Running {
+		return
+	}
+
+	me := g.Players[g.You]
+	counts := p.Profile.Actions[me.Speed]
+	if p.Profile.actionCount(me.Speed) < ProfileMinSamples {
+		p.Fallback.GetState(g)
+		return
+	}
+
+	candidates := g.candidateActions()
+	if me.stepCounter < ProfileEarlyRounds && g.random().Float64() < p.Profile.EarlyCrashRate()/ProfileEarlyRounds {
+		// Careless move like observed
+		candidates = g.legalActions()
+	}
+	total := 0
+	for _, a := range candidates {
+		total += counts[a] + 1
+	}
+	w := g.random().Intn(total)
+	action := candidates[len(candidates)-1]
+	for _, a := range candidates {
+		w -= counts[a] + 1
+		if w < 0 {
+			action = a
+			break
+		}
+	}
+
+	select {
+	case p.i <- action:
+	default:
+	}
+}
+
+// Name returns the name of the AI.
+func (p *ProfileAI) Name() string {
+	return "ProfileAI"
+}
+
+// profilesCommand shows and resets the opponent profiles.
+func profilesCommand(args []string) {
+	fs := flag.NewFlagSet("profiles", flag.ExitOnError)
+	file := fs.String("profiles", defaultUserFile(DefaultProfilesFile), "Opponent profiles file (see -profiles)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: sl_ow profiles [flags] [list | show NAME | reset [NAME]]")
+		fmt.Fprintln(fs.Output(), "Lists all opponent profiles, shows the actions of a single profile by speed or deletes profiles (all if no name is given).")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	s, err := loadProfiles(*file)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	switch {
+	case fs.NArg() == 0 || (fs.NArg() == 1 && fs.Arg(0) == "list"):
+		names := make([]string, 0, len(s.Profiles))
+		for name := range s.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "name\tgames\trounds\tjumps\tcrashes\tearly crashes\tleft turns\tupdated")
+		for _, name := range names {
+			p := s.Profiles[name]
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%.0f%%\t%.0f%%\t%s\n", strconv.Quote(name), p.Games, p.Rounds, p.Jumps, p.Crashes, p.EarlyCrashRate()*100, p.TurnLeftShare()*100, p.Updated.Local().Format("2006-01-02 15:04"))
+		}
+		w.Flush()
+	case fs.NArg() == 2 && fs.Arg(0) == "show":
+		p, ok := s.Profiles[fs.Arg(1)]
+		if !ok {
+			log.Fatalln("unknown profile", strconv.Quote(fs.Arg(1)))
+		}
+		speeds := make([]int, 0, len(p.Actions))
+		for speed := range p.Actions {
+			speeds = append(speeds, speed)
+		}
+		sort.Ints(speeds)
+		actions := []string{ActionNOOP, ActionTurnLeft, ActionTurnRight, ActionFaster, ActionSlower}
+		fmt.Printf("%s: %d games, %d rounds, %d jumps, %d crashes (%d early)\n\n", strconv.Quote(p.Name), p.Games, p.Rounds, p.Jumps, p.Crashes, p.EarlyCrashes)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprint(w, "speed\tn\t")
+		for _, a := range actions {
+			fmt.Fprintf(w, "%s\t", a)
+		}
+		fmt.Fprintln(w)
+		for _, speed := range speeds {
+			n := p.actionCount(speed)
+			fmt.Fprintf(w, "%d\t%d\t", speed, n)
+			for _, a := range actions {
+				fmt.Fprintf(w, "%.0f%%\t", float64(p.Actions[speed][a])/float64(n)*100)
+			}
+			fmt.Fprintln(w)
+		}
+		w.Flush()
+	case fs.NArg() <= 2 && fs.Arg(0) == "reset":
+		if fs.NArg() == 2 {
+			if _, ok := s.Profiles[fs.Arg(1)]; !ok {
+				log.Fatalln("unknown profile", strconv.Quote(fs.Arg(1)))
+			}
+			delete(s.Profiles, fs.Arg(1))
+		} else {
+			s.Profiles = make(map[string]*OpponentProfile)
+		}
+		err = s.save(*file)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
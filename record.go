@@ -0,0 +1,357 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+)
+
+const (
+	// DeathInvalidAction is the death cause of players without a valid action (including timeouts).
+	DeathInvalidAction = "invalid_action"
+	// DeathSpeed is the death cause of players leaving the allowed speed range.
+	DeathSpeed = "speed"
+	// DeathWall is the death cause of players leaving the board.
+	DeathWall = "wall"
+	// DeathCollision is the death cause of players crashing into a cell or another player.
+	DeathCollision = "collision"
+)
+
+// GameRecord is a move-by-move record of a game.
+// Replaying the actions of all rounds from the start position through the rules yields all states of the game.
+type GameRecord struct {
+	StartRound int           `json:"startRound"`
+	Start      *Game         `json:"start"`
+	Rounds     []RoundRecord `json:"rounds"`
+	Final      *Game         `json:"final"` // Last observed state, used for verification
+}
+
+// RoundRecord holds the actions of all players in a round.
+type RoundRecord struct {
+	Round   int            `json:"round"`
+	Actions map[int]string `json:"actions"` // Actions of all players active at the start of the round, empty for no valid action
+	Deaths  []DeathRecord  `json:"deaths,omitempty"`
+}
+
+// DeathRecord describes the death of a player.
+type DeathRecord struct {
+	Player int    `json:"player"`
+	Cause  string `json:"cause"`
+}
+
+// applyActions returns the state after processing a round with the given actions and the deaths in this round sorted by player.
+func (g *Game) applyActions(actions map[int]string) (*Game, []DeathRecord) {
+	next := g.PublicCopy()
+	max := 0
+	for k := range next.Players {
+		if k > max {
+			max = k
+		}
+	}
+	next.playerAnswer = make([]string, max)
+	for k, a := range actions {
+		next.playerAnswer[k-1] = a
+	}
+	next.processRound()
+	next.playerAnswer = nil
+	if next.checkEndGame() {
+		next.Running = false
+	}
+
+	var deaths []DeathRecord
+	for k, p := range g.Players {
+		np := next.Players[k]
+		if !p.Active || np.Active {
+			continue
+		}
+		d := DeathRecord{Player: k}
+		switch {
+		case !IsValidAction(actions[k]):
+			d.Cause = DeathInvalidAction
+		case np.Speed < 1 || np.Speed > next.rules().MaxSpeed:
+			d.Cause = DeathSpeed
+		case np.X < 0 || np.X >= next.Width || np.Y < 0 || np.Y >= next.Height:
+			d.Cause = DeathWall
+		default:
+			d.Cause = DeathCollision
+		}
+		deaths = append(deaths, d)
+	}
+	sort.Slice(deaths, func(i, j int) bool { return deaths[i].Player < deaths[j].Player })
+	return next, deaths
+}
+
+// sameState returns whether both games have the same cells and the same active players.
+// Positions, speed and direction are only compared for active players since they are not well defined for dead players.
+func (g *Game) sameState(o *Game) bool {
+	if g.Width != o.Width || g.Height != o.Height || len(g.Players) != len(o.Players) {
+		return false
+	}
+	for y := range g.Cells {
+		for x := range g.Cells[y] {
+			if g.Cells[y][x] != o.Cells[y][x] {
+				return false
+			}
+		}
+	}
+	for k, p := range g.Players {
+		q, ok := o.Players[k]
+		if !ok || p.Active != q.Active {
+			return false
+		}
+		if p.Active && (p.X != q.X || p.Y != q.Y || p.Speed != q.Speed || p.Direction != q.Direction) {
+			return false
+		}
+	}
+	return true
+}
+
+// inferRound returns the actions of all players which lead from old to new.
+// The actions are inferred from speed and direction changes. Players dying in this round might not show their action,
+// so all actions are tried for them and the combination reproducing the cells of new is used.
+func inferRound(old, new *Game) (map[int]string, []DeathRecord, error) {
+	actions := make(map[int]string, len(old.Players))
+	var dying []int
+	for k, p := range old.Players {
+		if !p.Active {
+			continue
+		}
+		np, ok := new.Players[k]
+		if !ok {
+			return nil, nil, fmt.Errorf("player %d missing", k)
+		}
+		actions[k] = inferAction(p, np)
+		if !np.Active {
+			dying = append(dying, k)
+		}
+	}
+	sort.Ints(dying)
+
+	var try func(i int) (*Game, []DeathRecord)
+	try = func(i int) (*Game, []DeathRecord) {
+		if i == len(dying) {
+			next, deaths := old.applyActions(actions)
+			if next.sameState(new) {
+				return next, deaths
+			}
+			return nil, nil
+		}
+		inferred := actions[dying[i]]
+		candidates := []string{inferred}
+		for _, a := range []string{ActionNOOP, ActionSlower, ActionFaster, ActionTurnLeft, ActionTurnRight, ""} {
+			if a != inferred {
+				candidates = append(candidates, a)
+			}
+		}
+		for _, a := range candidates {
+			actions[dying[i]] = a
+			if next, deaths := try(i + 1); next != nil {
+				return next, deaths
+			}
+		}
+		actions[dying[i]] = inferred
+		return nil, nil
+	}
+	next, deaths := try(0)
+	if next == nil {
+		return nil, nil, errors.New("no combination of actions reproduces the next state")
+	}
+	return actions, deaths, nil
+}
+
+// newGameRecord creates a record from the states of consecutive rounds starting at startRound.
+func newGameRecord(states []*Game, startRound int) (*GameRecord, error) {
+	if len(states) == 0 {
+		return nil, errors.New("no states")
+	}
+	r := &GameRecord{
+		StartRound: startRound,
+		Start:      states[0].PublicCopy(),
+		Final:      states[len(states)-1].PublicCopy(),
+	}
+	for i := 1; i < len(states); i++ {
+		old := states[i-1].PublicCopy()
+		for k := range old.Players {
+			old.Players[k].stepCounter = startRound + i - 2
+		}
+		actions, deaths, err := inferRound(old, states[i])
+		if err != nil {
+			return nil, fmt.Errorf("round %d: %w", startRound+i-1, err)
+		}
+		r.Rounds = append(r.Rounds, RoundRecord{Round: startRound + i - 1, Actions: actions, Deaths: deaths})
+	}
+	return r, nil
+}
+
+// replay returns all states of the game by applying the recorded actions to the start position.
+func (r *GameRecord) replay() ([]*Game, error) {
+	if r.Start == nil {
+		return nil, errors.New("record has no start position")
+	}
+	g := r.Start.PublicCopy()
+	for k := range g.Players {
+		g.Players[k].stepCounter = r.StartRound - 1
+	}
+	states := []*Game{g}
+	for i, round := range r.Rounds {
+		if round.Round != r.StartRound+i {
+			return nil, fmt.Errorf("round %d missing", r.StartRound+i)
+		}
+		for k := range round.Actions {
+			if g.Players[k] == nil {
+				return nil, fmt.Errorf("round %d: unknown player %d", round.Round, k)
+			}
+		}
+		var deaths []DeathRecord
+		g, deaths = g.applyActions(round.Actions)
+		if len(deaths) != len(round.Deaths) {
+			return nil, fmt.Errorf("round %d: %d deaths recorded, %d replayed", round.Round, len(round.Deaths), len(deaths))
+		}
+		for j := range deaths {
+			if deaths[j] != round.Deaths[j] {
+				return nil, fmt.Errorf("round %d: recorded death %v, replayed %v", round.Round, round.Deaths[j], deaths[j])
+			}
+		}
+		states = append(states, g)
+	}
+	return states, nil
+}
+
+// verify replays the record and compares the result with the final state.
+func (r *GameRecord) verify() error {
+	states, err := r.replay()
+	if err != nil {
+		return err
+	}
+	if r.Final != nil && !states[len(states)-1].sameState(r.Final) {
+		return errors.New("replay does not reproduce the final state")
+	}
+	return nil
+}
+
+// recordFromDump creates a record from a dump (see -dump).
+func recordFromDump(states []GameData) (*GameRecord, error) {
+	games := make([]*Game, 0, len(states))
+	start := 0
+	for _, s := range states {
+		if s.Game == nil {
+			continue
+		}
+		if len(games) == 0 {
+			start = s.Round
+		} else if s.Round != start+len(games) {
+			return nil, fmt.Errorf("round %d missing in dump", start+len(games))
+		}
+		games = append(games, s.Game)
+	}
+	return newGameRecord(games, start)
+}
+
+// loadRecord reads a record written by recordUI or 'sl_ow record convert'.
+func loadRecord(file string) (*GameRecord, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var r GameRecord
+	err = json.Unmarshal(b, &r)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// writeRecord writes a record as JSON.
+func writeRecord(file string, r *GameRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(b, '\n'), 0644)
+}
+
+// recordCommand converts dumps into records, verifies records and prints them.
+func recordCommand(args []string) {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: sl_ow record convert dump record")
+		fmt.Fprintln(fs.Output(), "       sl_ow record verify record")
+		fmt.Fprintln(fs.Output(), "       sl_ow record show record")
+		fmt.Fprintln(fs.Output(), "Game records contain the actions of all players in every round (see -record).")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	switch {
+	case fs.NArg() == 3 && fs.Arg(0) == "convert":
+		states, err := loadDump(fs.Arg(1))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		r, err := recordFromDump(states)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		err = writeRecord(fs.Arg(2), r)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	case fs.NArg() == 2 && fs.Arg(0) == "verify":
+		r, err := loadRecord(fs.Arg(1))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		err = r.verify()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Printf("%d rounds verified\n", len(r.Rounds))
+	case fs.NArg() == 2 && fs.Arg(0) == "show":
+		r, err := loadRecord(fs.Arg(1))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, round := range r.Rounds {
+			ids := make([]int, 0, len(round.Actions))
+			for k := range round.Actions {
+				ids = append(ids, k)
+			}
+			sort.Ints(ids)
+			fmt.Printf("round %d:", round.Round)
+			for _, k := range ids {
+				a := round.Actions[k]
+				if a == "" {
+					a = "-"
+				}
+				fmt.Printf(" %d=%s", k, a)
+			}
+			for _, d := range round.Deaths {
+				fmt.Printf(" | %d died (%s)", d.Player, d.Cause)
+			}
+			fmt.Println()
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// recordingAI remembers the last answer of the wrapped AI.
+type recordingAI struct {
+	AI
+	c    chan string
+	last string
+}
+
+func (r *recordingAI) GetChannel(c chan string) {
+	r.c = c
+}
+
+func (r *recordingAI) GetState(g *Game) {
+	inner := make(chan string, 1)
+	r.AI.GetChannel(inner)
+	r.AI.GetState(g)
+	r.last = ""
+	select {
+	case r.last = <-inner:
+		r.c <- r.last
+	default:
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sl_ow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rand.Seed(1)
+	for game := 0; game < 5; game++ {
+		g := newGame(20, 20, 4)
+		ais := make(map[int]*recordingAI)
+		for k, name := range []string{"RandomAI", "SnailAI", "StupidAI", "BadRandomAI"} {
+			ais[k+1] = &recordingAI{AI: NewAI(name)}
+			g.Players[k+1].ai = ais[k+1]
+		}
+
+		states := []*Game{g.PublicCopy()}
+		var taken []map[int]string
+		for g.Running {
+			g.advance()
+			actions := make(map[int]string)
+			for k := range ais {
+				actions[k] = ais[k].last
+			}
+			taken = append(taken, actions)
+			states = append(states, g.PublicCopy())
+		}
+
+		r, err := newGameRecord(states, 1)
+		if err != nil {
+			t.Fatalf("game %d: %s", game, err)
+		}
+		file := filepath.Join(dir, "record.json")
+		err = writeRecord(file, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err = loadRecord(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.verify()
+		if err != nil {
+			t.Fatalf("game %d: %s", game, err)
+		}
+
+		replayed, err := r.replay()
+		if err != nil {
+			t.Fatalf("game %d: %s", game, err)
+		}
+		if len(replayed) != len(states) {
+			t.Fatalf("game %d: %d states replayed, %d played", game, len(replayed), len(states))
+		}
+		for i := range states {
+			if !replayed[i].sameState(states[i]) {
+				t.Fatalf("game %d: state %d differs after replay", game, i)
+			}
+		}
+
+		// Actions of surviving players are unique
+		for i, round := range r.Rounds {
+			for k, a := range round.Actions {
+				if states[i+1].Players[k].Active && a != taken[i][k] {
+					t.Errorf("game %d round %d player %d: inferred %s, taken %s", game, round.Round, k, a, taken[i][k])
+				}
+			}
+		}
+	}
+}
+
+func TestRecordUnknownPlayer(t *testing.T) {
+	g := newGame(10, 10, 2)
+	for _, k := range []int{0, -1, 3} {
+		r := &GameRecord{
+			StartRound: 1,
+			Start:      g.PublicCopy(),
+			Rounds:     []RoundRecord{{Round: 1, Actions: map[int]string{1: ActionNOOP, 2: ActionNOOP, k: ActionNOOP}}},
+		}
+		err := r.verify()
+		if err == nil || err.Error() != fmt.Sprintf("round 1: unknown player %d", k) {
+			t.Errorf("player %d: error %v", k, err)
+		}
+	}
+}
+
+func TestSameState(t *testing.T) {
+	g := newGame(10, 10, 2)
+	g.Players[2].Active = false
+
+	o := g.PublicCopy()
+	if !g.sameState(o) {
+		t.Fatal("copy differs")
+	}
+
+	o.Players[2].X = (o.Players[2].X + 1) % o.Width
+	o.Players[2].Speed = 3
+	if !g.sameState(o) {
+		t.Error("position and speed of dead player are compared")
+	}
+
+	o = g.PublicCopy()
+	o.Players[1].Speed = 2
+	if g.sameState(o) {
+		t.Error("speed of active player is ignored")
+	}
+
+	o = g.PublicCopy()
+	o.Players[2].Active = true
+	if g.sameState(o) {
+		t.Error("active players are ignored")
+	}
+
+	o = g.PublicCopy()
+	o.Cells[0][0]++
+	if g.sameState(o) {
+		t.Error("cells are ignored")
+	}
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// replayCommand shows a dump (see -dump) in the terminal ui.
+func replayCommand(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: sl_ow replay dump")
+		fmt.Fprintln(fs.Output(), "Shows a dump in the terminal ui. Use left/right to select the round, o to toggle the heatmap overlay, p to show the opponents, c for compact mode, hjkl to scroll and q to quit.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	states, err := loadDump(fs.Arg(0))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(states) == 0 {
+		log.Fatalln("dump contains no game states")
+	}
+
+	tui := &terminalUI{Replay: states}
+	err = tui.Initialise()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	tui.Wait()
+}
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"sync"
+)
+
+// rootSampler selects the first action of the simulations with UCB1 so that promising actions get more simulations.
+// The reward of a simulation is the mean of the win (0 or 1) and the survived rounds relative to the longest survival seen.
+// It is safe for concurrent use.
+type rootSampler struct {
+	l sync.Mutex
+
+	actions     []string
+	run         []int
+	pending     []int
+	won         []int
+	survived    []int
+	longest     int
+	exploration float64
+}
+
+// newRootSampler returns a sampler over all first actions of g which are not certainly fatal.
+func newRootSampler(g *Game, exploration float64) *rootSampler {
+	actions := g.candidateActions()
+	return &rootSampler{
+		actions:     actions,
+		run:         make([]int, len(actions)),
+		pending:     make([]int, len(actions)),
+		won:         make([]int, len(actions)),
+		survived:    make([]int, len(actions)),
+		exploration: exploration,
+	}
+}
+
+// legalActions returns all actions which are not rejected immediately because of the speed limits.
+func (g *Game) legalActions() []string {
+	actions := make([]string, 0, 5)
+	for _, a := range []string{ActionTurnLeft, ActionTurnRight, ActionSlower, ActionFaster, ActionNOOP} {
+		if a == ActionSlower && g.Players[g.You].Speed == 1 {
+			continue
+		}
+		if a == ActionFaster && g.Players[g.You].Speed == g.rules().MaxSpeed {
+			continue
+		}
+		actions = append(actions, a)
+	}
+	return actions
+}
+
+// next returns the index of the action which should be simulated next.
+// Running simulations count as lost until update is called so that parallel workers spread over the actions.
+func (s *rootSampler) next() int {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	total := 0
+	for i := range s.actions {
+		total += s.run[i] + s.pending[i]
+	}
+
+	best := 0
+	bestValue := math.Inf(-1)
+	for i := range s.actions {
+		n := s.run[i] + s.pending[i]
+		if n == 0 {
+			best = i
+			break
+		}
+		mean := 0.0
+		if s.run[i] > 0 {
+			mean = 0.5 * float64(s.won[i]) / float64(n)
+			if s.longest > 0 {
+				mean += 0.5 * float64(s.survived[i]) / float64(n) / float64(s.longest)
+			}
+		}
+		value := mean + s.exploration*math.Sqrt(math.Log(float64(total))/float64(n))
+		if value > bestValue {
+			best = i
+			bestValue = value
+		}
+	}
+	s.pending[best]++
+	return best
+}
+
+// update adds the result of a simulation started by next.
+func (s *rootSampler) update(i int, win bool, survived int) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.pending[i]--
+	s.run[i]++
+	if win {
+		s.won[i]++
+	}
+	s.survived[i] += survived
+	if survived > s.longest {
+		s.longest = survived
+	}
+}
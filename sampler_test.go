@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+// samplerTestGame returns a 10x10 board with a single player in the centre, so that four actions are not fatal.
+func samplerTestGame() *Game {
+	g := &Game{
+		Width:   10,
+		Height:  10,
+		Cells:   make([][]int8, 10),
+		You:     1,
+		Running: true,
+		Players: map[int]*Player{
+			1: {X: 5, Y: 5, Direction: DirectionUp, Speed: 1, Active: true},
+		},
+	}
+	for y := range g.Cells {
+		g.Cells[y] = make([]int8, g.Width)
+	}
+	g.Cells[5][5] = 1
+	return g
+}
+
+func TestRootSamplerExploresFirst(t *testing.T) {
+	s := newRootSampler(samplerTestGame(), DefaultParameters.Exploration)
+	if len(s.actions) != 4 {
+		t.Fatalf("actions %v, want 4 actions", s.actions)
+	}
+
+	// Running simulations must spread over the actions
+	seen := make(map[int]bool)
+	for range s.actions {
+		a := s.next()
+		if seen[a] {
+			t.Fatalf("action %s selected twice before all actions were selected", s.actions[a])
+		}
+		seen[a] = true
+	}
+	for a := range s.actions {
+		s.update(a, false, 0)
+	}
+
+	// Finished simulations as well, even if the first action is a sure win
+	s = newRootSampler(samplerTestGame(), DefaultParameters.Exploration)
+	seen = make(map[int]bool)
+	for range s.actions {
+		a := s.next()
+		if seen[a] {
+			t.Fatalf("action %s selected twice before all actions were selected", s.actions[a])
+		}
+		seen[a] = true
+		s.update(a, a == 0, 10)
+	}
+}
+
+func TestRootSamplerExploits(t *testing.T) {
+	tests := []struct {
+		name     string
+		best     int
+		win      bool // Whether the best action wins, all other actions lose
+		survived []int
+	}{
+		{"winning action first", 0, true, []int{20, 10, 10, 10}},
+		{"winning action last", 3, true, []int{10, 10, 10, 20}},
+		{"longest survival", 1, false, []int{5, 30, 5, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newRootSampler(samplerTestGame(), DefaultParameters.Exploration)
+			const pulls = 2000
+			for i := 0; i < pulls; i++ {
+				a := s.next()
+				s.update(a, tt.win && a == tt.best, tt.survived[a])
+			}
+			for a := range s.actions {
+				if s.pending[a] != 0 {
+					t.Errorf("action %s: %d pending", s.actions[a], s.pending[a])
+				}
+				if s.run[a] == 0 {
+					t.Errorf("action %s never simulated", s.actions[a])
+				}
+			}
+			if s.run[tt.best] < pulls/2 {
+				t.Errorf("best action %s simulated %d of %d times (all: %v)", s.actions[tt.best], s.run[tt.best], pulls, s.run)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// websocketAI lets the client of a websocket connection play a player of a local game.
+// A client which does not answer in time is treated like on the official server and can not answer in later rounds.
+type websocketAI struct {
+	conn     *websocket.Conn
+	deadline time.Duration
+	i        chan string
+	err      error
+}
+
+// GetChannel receives the answer channel.
+func (w *websocketAI) GetChannel(c chan string) {
+	w.i = c
+}
+
+// GetState sends the game state to the client and waits for the answer until the deadline.
+func (w *websocketAI) GetState(g *Game) {
+	deadline := w.send(g)
+	if w.err != nil {
+		return
+	}
+	w.conn.SetReadDeadline(deadline)
+	_, b, err := w.conn.ReadMessage()
+	if err != nil {
+		w.err = err
+		return
+	}
+	var a Action
+	err = json.Unmarshal(b, &a)
+	if err != nil {
+		return
+	}
+	w.i <- a.Action
+}
+
+// send sends the game state with a new deadline to the client and returns the deadline.
+func (w *websocketAI) send(g *Game) time.Time {
+	// The deadline is only transmitted in seconds, so the client never gets more time than announced
+	deadline := time.Now().Add(w.deadline).Truncate(time.Second)
+	if w.err != nil {
+		return deadline
+	}
+	g.Deadline = deadline.UTC().Format(time.RFC3339)
+	b, err := json.Marshal(g)
+	if err != nil {
+		w.err = err
+		return deadline
+	}
+	w.err = w.conn.WriteMessage(websocket.TextMessage, b)
+	return deadline
+}
+
+// Name returns the name of the AI.
+func (w *websocketAI) Name() string {
+	return "websocket client"
+}
+
+// serveOptions holds the settings of the local game server.
+type serveOptions struct {
+	Width, Height, Players int
+	Bots                   []string // AIs of the opponents, AIs out of the rotation if empty
+	Deadline               time.Duration
+	Rules                  Rules
+}
+
+// serveGame plays a local game against bots with the client of conn as one of the players.
+// The board, the bots and their decisions only depend on seed and the actions of the client.
+func serveGame(conn *websocket.Conn, opts serveOptions, seed int64) {
+	defer conn.Close()
+
+	r := rand.New(rand.NewSource(seed))
+	g := newGameFrom(r, opts.Width, opts.Height, opts.Players)
+	g.Rules = &opts.Rules
+	g.You = 1 + r.Intn(opts.Players)
+	client := &websocketAI{conn: conn, deadline: opts.Deadline}
+	bot := 0
+	for k := range g.Players {
+		switch {
+		case k == g.You:
+			g.Players[k].ai = client
+		case len(opts.Bots) == 0:
+			g.Players[k].ai = aiRotation[r.Intn(len(aiRotation))]()
+		default:
+			g.Players[k].ai = NewAI(opts.Bots[bot%len(opts.Bots)])
+			bot++
+		}
+		if k != g.You {
+			g.Players[k].Name = g.Players[k].ai.Name()
+		}
+	}
+
+	round := 0
+	for g.Running {
+		round++
+		if !g.Players[g.You].Active {
+			// Dead clients still receive all rounds
+			client.send(g.PublicCopy())
+		}
+		g.advance()
+	}
+	client.send(g.PublicCopy())
+	if client.err != nil {
+		log.Println("serve:", conn.RemoteAddr(), client.err)
+	}
+
+	winner := 0
+	for k, p := range g.Players {
+		if p.Active {
+			winner = k
+		}
+	}
+	log.Printf("serve: %s played player %d (seed %d), game ended after %d rounds, winner %d", conn.RemoteAddr(), g.You, seed, round, winner)
+}
+
+// serveCommand runs a local server speaking the protocol of the official server.
+// Every connection plays its own game against bots.
+func serveCommand(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8080", "Address to listen on")
+	width := fs.Int("width", 50, "Width of the board")
+	height := fs.Int("height", 50, "Height of the board")
+	players := fs.Int("players", 6, "Number of players including the client")
+	bots := listFlag{}
+	fs.Var(&bots, "bots", "Comma separated list of AIs used for the opponents in turn (default AIs out of the rotation)")
+	deadline := fs.Duration("deadline", 5*time.Second, "Time per round the client has to answer")
+	seed := fs.Int64("seed", 0, "Seed of the first game, following games use the next seeds, 0 uses the current time")
+	rules := DefaultRules
+	fs.IntVar(&rules.FieldMaxSize, "field-max-size", rules.FieldMaxSize, "Maximum width and height of the board")
+	fs.IntVar(&rules.HolesEachStep, "holes-each-step", rules.HolesEachStep, "Number of steps after which holes might occur")
+	fs.IntVar(&rules.HoleSpeed, "hole-speed", rules.HoleSpeed, "Minimum speed needed for holes")
+	fs.IntVar(&rules.MaxSpeed, "max-speed", rules.MaxSpeed, "Maximum speed")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: sl_ow serve [flags]")
+		fmt.Fprintln(fs.Output(), "Runs a local game server. Every websocket connection plays its own game against bots, e.g. 'URL=ws://localhost:8080 KEY=local sl_ow'.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	err := rules.Validate()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if *width < 1 || *height < 1 || *width > rules.FieldMaxSize || *height > rules.FieldMaxSize {
+		log.Fatalf("width and height must be between 1 and %d", rules.FieldMaxSize)
+	}
+	if *players < 1 || *players > *width**height || *players > MaxPlayers {
+		log.Fatalln("invalid number of players")
+	}
+	for _, b := range bots {
+		if NewAI(b) == nil {
+			log.Fatalln("unknown ai", b)
+		}
+	}
+	if *deadline < 2*time.Second {
+		log.Fatalln("deadline must be at least 2s")
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	opts := serveOptions{
+		Width:    *width,
+		Height:   *height,
+		Players:  *players,
+		Bots:     []string(bots),
+		Deadline: *deadline,
+		Rules:    rules,
+	}
+
+	games := *seed - 1
+	upgrader := websocket.Upgrader{}
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println("serve:", err)
+			return
+		}
+		serveGame(conn, opts, atomic.AddInt64(&games, 1))
+	})
+	log.Println("serve: listening on", *addr)
+	log.Fatalln(http.ListenAndServe(*addr, nil))
+}
@@ -0,0 +1,265 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultSessionPrint is the output file of sessions if no print file is configured.
+const DefaultSessionPrint = "session.txt"
+
+// runSession plays a game on the server configured in config and returns whether it was won.
+// input receives the actions of a human player in play mode and must be nil otherwise.
+// If pool is not nil, all local simulations run on it.
+func runSession(config Config, UI UI, input chan string, pool *WorkerPool) bool {
+	url := fmt.Sprintf("%s?key=%s", config.Endpoint, url.QueryEscape(config.Key))
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{})
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	err = UI.Initialise()
+	if err != nil {
+		panic(err)
+	}
+
+	var mastergame *Game
+	round := 0
+	lastAlive := 0
+	engine := Engine{Workers: config.NumberWorker(), Pool: pool, Remote: newRemoteWorkers(config.Engine.Remote), Rollout: config.Engine.Rollout, Parameters: &config.Parameters, Heatmap: config.Engine.Heatmap}
+	engine.Progress = UI.Progress
+	tracker := newOpponentTracker()
+	var profiles *ProfileStore
+	if config.Engine.Profiles != "" {
+		profiles, err = loadProfiles(config.Engine.Profiles)
+		if err != nil {
+			log.Println("can not load opponent profiles:", err)
+		}
+	}
+	var ponder *ponderer
+	var configHash string
+	jumpsObserved := 0
+	var start time.Time
+
+	for {
+		round++
+		_, b, err := conn.ReadMessage()
+		received := time.Now()
+		ponder.stop()
+		if err != nil {
+			log.Panicln(err)
+		}
+		if start.IsZero() {
+			start = time.Now()
+		}
+		mastergame = new(Game)
+		err = json.Unmarshal(b, mastergame)
+		if err != nil {
+			log.Panicln(err)
+		}
+		// Add round since that is not transmitted
+		for k := range mastergame.Players {
+			mastergame.Players[k].stepCounter = round - 1
+		}
+
+		if round == 1 {
+			configHash = config.Hash(*mastergame.rules())
+		}
+
+		opponents, territory := tracker.update(mastergame)
+		if round == 1 && profiles != nil {
+			engine.Profiles = profiles.forGame(mastergame)
+		}
+
+		if mastergame.Running == false || !mastergame.Players[mastergame.You].Active {
+			data := newGameData(mastergame, round)
+			data.Opponents = opponents
+			data.Territory = territory
+			data.Jumps = jumpsObserved
+			data.Runtime = time.Now().Sub(start)
+			data.Config = configHash
+			UI.NewData(data)
+		}
+
+		if mastergame.Running == false {
+			break
+		}
+
+		mastergame.PopulateInternalCellsFlat()
+
+		UI.NewRound(mastergame.PublicCopy(), round)
+
+		if !mastergame.Players[mastergame.You].Active {
+			continue
+		}
+
+		lastAlive = round
+
+		deadline, err := time.Parse(time.RFC3339, mastergame.Deadline)
+		if err != nil {
+			log.Panicln(err)
+		}
+		if config.MaxDuration > 0 {
+			test := time.Now().Add(time.Duration(config.MaxDuration))
+			if test.Before(deadline) {
+				deadline = test
+			}
+		}
+		ctxWorker, ctxWorkerCancel := context.WithDeadline(context.Background(), deadline.Add(-time.Duration(config.Engine.WorkerMargin)))
+		ctxMain, ctxMainCancel := context.WithDeadline(context.Background(), deadline.Add(-time.Duration(config.Engine.CollectMargin)))
+
+		data := newGameData(mastergame, round)
+		data.Deadline = deadline
+		data.Opponents = opponents
+		data.Territory = territory
+		if pondered, ok := ponder.lookup(mastergame); ok {
+			data.merge(pondered)
+			for k := range pondered.Collect {
+				data.Pondered += pondered.Collect[k].Run
+			}
+		}
+		ponder = nil
+
+		var human <-chan string
+		if input != nil {
+			human = awaitHuman(ctxMain, input)
+		}
+
+		engine.Run(ctxWorker, ctxMain, mastergame, &data)
+
+		humanAction := ""
+		if human != nil {
+			// The human can change the choice until the deadline even if the engine stopped early
+			humanAction = <-human
+		}
+
+		ctxWorkerCancel()
+		ctxMainCancel()
+
+		data.decide(engine.params())
+
+		if input != nil {
+			switch {
+			case humanAction != "":
+				data.Reason = fmt.Sprintf("human (engine: %s)", data.Action)
+				data.Action = humanAction
+			case config.UI.PlayDefault != PlayDefaultEngine:
+				data.Reason = fmt.Sprintf("no input, default (engine: %s)", data.Action)
+				data.Action = config.UI.PlayDefault
+			default:
+				data.Reason = fmt.Sprintf("no input, engine (%s)", data.Reason)
+			}
+		}
+
+		answer, err := json.Marshal(Action{data.Action})
+		if err != nil {
+			log.Panicln(err)
+		}
+		err = conn.WriteMessage(websocket.TextMessage, answer)
+		if err != nil {
+			log.Panicln(err)
+		}
+		data.Thinking = time.Now().Sub(received)
+
+		if config.Engine.Ponder {
+			ponder = engine.startPondering(mastergame, data.Action, round+1)
+		}
+
+		if isJump(mastergame.PublicCopy(), data.Action) {
+			jumpsObserved++
+		}
+
+		data.Jumps = jumpsObserved
+		data.Runtime = time.Now().Sub(start)
+		data.Config = configHash
+
+		UI.NewData(data)
+	}
+
+	if config.Engine.Profiles != "" {
+		err = updateProfiles(config.Engine.Profiles, tracker.profiles())
+		if err != nil {
+			log.Println("can not save opponent profiles:", err)
+		}
+	}
+
+	won := mastergame.Players[mastergame.You].Active
+	UI.Finish(won, lastAlive, round)
+	UI.Wait()
+	return won
+}
+
+// runSessions plays one game per key of config.Sessions concurrently.
+// All sessions share one worker pool, each session writes into its own files (see sessionConfig).
+func runSessions(config Config) {
+	pool := NewWorkerPool(config.NumberWorker())
+	defer pool.Close()
+	var wg sync.WaitGroup
+	for i, key := range config.Sessions {
+		wg.Add(1)
+		go func(i int, c Config) {
+			defer wg.Done()
+			var UI UI = quietUI{}
+			defer func() {
+				err := recover()
+				if err != nil {
+					UI.Finish(false, -1, -1)
+					UI.Wait()
+					log.Printf("session %d: %v", i, err)
+				}
+			}()
+			UI = wrapUI(c, UI)
+			won := runSession(c, UI, nil, pool)
+			log.Printf("session %d: won %t (output: %s)", i, won, c.UI.Print)
+		}(i+1, sessionConfig(config, i+1, key))
+	}
+	wg.Wait()
+}
+
+// sessionConfig returns the configuration of session i (starting at 1) using the given key.
+// The session number is added to all output files. Human readable output is always written, by default to DefaultSessionPrint.
+func sessionConfig(c Config, i int, key string) Config {
+	c.Key = key
+	c.Sessions = nil
+	if c.UI.Print == "" {
+		c.UI.Print = DefaultSessionPrint
+	}
+	for _, f := range []*string{&c.UI.Print, &c.UI.Dump, &c.UI.Record, &c.UI.PrintWin, &c.UI.Log} {
+		if *f != "" && *f != "-" {
+			*f = sessionFile(*f, i)
+		}
+	}
+	return c
+}
+
+// sessionFile adds the session number in front of the extension of file.
+func sessionFile(file string, i int) string {
+	ext := filepath.Ext(file)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(file, ext), i, ext)
+}
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+)
+
+// ConfidenceZ is the quantile of the normal distribution used for all confidence intervals (95%).
+const ConfidenceZ = 1.96
+
+// wilsonInterval returns the Wilson score interval of a success rate.
+// For n == 0, the interval is [0, 1].
+func wilsonInterval(successes, n int, z float64) (float64, float64) {
+	if n == 0 {
+		return 0, 1
+	}
+	fn := float64(n)
+	p := float64(successes) / fn
+	z2 := z * z
+	centre := (p + z2/(2*fn)) / (1 + z2/fn)
+	margin := z / (1 + z2/fn) * math.Sqrt(p*(1-p)/fn+z2/(4*fn*fn))
+	// The interval always contains p, but rounding might move the bounds of p = 0 and p = 1
+	return math.Min(p, math.Max(0, centre-margin)), math.Max(p, math.Min(1, centre+margin))
+}
+
+// normalInterval returns the normal approximation interval of a mean given the sum and the sum of squares of n samples.
+// For n < 2, the interval is unbounded.
+func normalInterval(sum, sumSquared float64, n int, z float64) (float64, float64) {
+	if n < 2 {
+		return math.Inf(-1), math.Inf(1)
+	}
+	fn := float64(n)
+	mean := sum / fn
+	variance := (sumSquared - fn*mean*mean) / (fn - 1)
+	if variance < 0 {
+		// Rounding errors
+		variance = 0
+	}
+	margin := z * math.Sqrt(variance/fn)
+	return mean - margin, mean + margin
+}
+
+// WinChance returns the observed win chance of the action.
+func (d ActionData) WinChance() float64 {
+	if d.Run == 0 {
+		return 0
+	}
+	return float64(d.Won) / float64(d.Run)
+}
+
+// AverageLength returns the observed average number of survived rounds of the action.
+func (d ActionData) AverageLength() float64 {
+	if d.Run == 0 {
+		return 0
+	}
+	return float64(d.Survived) / float64(d.Run)
+}
+
+// WinInterval returns the Wilson score interval of the win chance.
+func (d ActionData) WinInterval() (float64, float64) {
+	return wilsonInterval(d.Won, d.Run, ConfidenceZ)
+}
+
+// LengthInterval returns the normal approximation interval of the average length.
+func (d ActionData) LengthInterval() (float64, float64) {
+	return normalInterval(float64(d.Survived), float64(d.SurvivedSquared), d.Run, ConfidenceZ)
+}
+
+// indistinguishable returns whether the win chance and the average length of both actions can not be told apart statistically,
+// i.e. both of their confidence intervals overlap.
+func indistinguishable(a, b ActionData) bool {
+	return overlap(a, b, ActionData.WinInterval) && overlap(a, b, ActionData.LengthInterval)
+}
+
+// overlap returns whether the intervals of both actions overlap.
+func overlap(a, b ActionData, interval func(ActionData) (float64, float64)) bool {
+	aLow, aHigh := interval(a)
+	bLow, bHigh := interval(b)
+	return aLow <= bHigh && bLow <= aHigh
+}
+
+// dominant returns the action which is better than all other simulated actions with statistical confidence.
+// An action dominates another if its win chance is higher or if its win chance is not lower and its average length is higher.
+// The dominant action needs at least minRuns simulations.
+func (gd *GameData) dominant(minRuns int) (string, bool) {
+	best := gd.leader()
+	if best == "" || gd.Collect[best].Run < minRuns {
+		return "", false
+	}
+
+	b := gd.Collect[best]
+	winLow, _ := b.WinInterval()
+	lengthLow, _ := b.LengthInterval()
+	for k := range gd.Collect {
+		d := gd.Collect[k]
+		if k == best || d.Run == 0 {
+			continue
+		}
+		_, winHigh := d.WinInterval()
+		if winLow > winHigh {
+			continue
+		}
+		_, lengthHigh := d.LengthInterval()
+		if b.WinChance() >= d.WinChance() && lengthLow > lengthHigh {
+			continue
+		}
+		return "", false
+	}
+	return best, true
+}
+
+// leader returns the simulated action with the highest win chance. Ties are broken by the average length.
+// It returns an empty string if no action is simulated yet.
+func (gd *GameData) leader() string {
+	best := ""
+	for k := range gd.Collect {
+		d := gd.Collect[k]
+		if d.Run == 0 {
+			continue
+		}
+		if best == "" || d.WinChance() > gd.Collect[best].WinChance() || (d.WinChance() == gd.Collect[best].WinChance() && d.AverageLength() > gd.Collect[best].AverageLength()) {
+			best = k
+		}
+	}
+	return best
+}
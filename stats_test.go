@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWilsonInterval(t *testing.T) {
+	tests := []struct {
+		successes, n int
+		low, high    float64
+	}{
+		{0, 0, 0, 1},
+		{0, 1, 0, 0.7935},
+		{1, 1, 0.2065, 1},
+		{0, 10, 0, 0.2775},
+		{10, 10, 0.7225, 1},
+		{5, 10, 0.2366, 0.7634},
+		{81, 263, 0.2553, 0.3662},
+	}
+	for _, tt := range tests {
+		low, high := wilsonInterval(tt.successes, tt.n, ConfidenceZ)
+		if math.Abs(low-tt.low) > 1e-4 || math.Abs(high-tt.high) > 1e-4 {
+			t.Errorf("wilsonInterval(%d, %d) = [%f, %f], want [%f, %f]", tt.successes, tt.n, low, high, tt.low, tt.high)
+		}
+	}
+
+	// p = 0 and p = 1 must not leave [0, 1] due to rounding
+	for n := 1; n <= 10000; n *= 3 {
+		for _, successes := range []int{0, n} {
+			low, high := wilsonInterval(successes, n, ConfidenceZ)
+			if low < 0 || high > 1 || low > high {
+				t.Errorf("wilsonInterval(%d, %d) = [%g, %g] not within [0, 1]", successes, n, low, high)
+			}
+			p := float64(successes) / float64(n)
+			if p < low || p > high {
+				t.Errorf("wilsonInterval(%d, %d) = [%g, %g] does not contain %g", successes, n, low, high, p)
+			}
+		}
+	}
+}
+
+func TestNormalInterval(t *testing.T) {
+	for n := 0; n < 2; n++ {
+		low, high := normalInterval(5, 25, n, ConfidenceZ)
+		if !math.IsInf(low, -1) || !math.IsInf(high, 1) {
+			t.Errorf("n = %d: [%f, %f], want unbounded", n, low, high)
+		}
+	}
+
+	// Sample standard deviation 2.138 around the mean 5
+	d := simulated(8, 0, 2, 4, 4, 4, 5, 5, 7, 9)
+	low, high := normalInterval(float64(d.Survived), float64(d.SurvivedSquared), d.Run, ConfidenceZ)
+	if math.Abs(low-3.5184) > 1e-4 || math.Abs(high-6.4816) > 1e-4 {
+		t.Errorf("interval [%f, %f], want [3.5184, 6.4816]", low, high)
+	}
+
+	// Rounding must not result in a negative variance
+	d = simulated(3, 0, 7)
+	low, high = normalInterval(float64(d.Survived)+1e-12, float64(d.SurvivedSquared), d.Run, ConfidenceZ)
+	if math.IsNaN(low) || math.IsNaN(high) || math.Abs(low-7) > 1e-9 || math.Abs(high-7) > 1e-9 {
+		t.Errorf("constant samples: [%f, %f], want [7, 7]", low, high)
+	}
+}
+
+// simulated returns the data of run simulations with won wins. The survived rounds cycle through lengths.
+func simulated(run, won int, lengths ...int) ActionData {
+	d := ActionData{Run: run, Won: won}
+	for i := 0; i < run; i++ {
+		l := lengths[i%len(lengths)]
+		d.Survived += l
+		d.SurvivedSquared += int64(l) * int64(l)
+	}
+	return d
+}
+
+func TestDominant(t *testing.T) {
+	tests := []struct {
+		name    string
+		collect map[string]ActionData
+		minRuns int
+		action  string
+		ok      bool
+	}{
+		{
+			name:    "no results",
+			collect: map[string]ActionData{},
+			minRuns: 10,
+		},
+		{
+			name:    "before EarlyStopRuns",
+			collect: map[string]ActionData{ActionTurnLeft: simulated(100, 100, 50), ActionTurnRight: simulated(100, 0, 5)},
+			minRuns: DefaultParameters.EarlyStopRuns,
+		},
+		{
+			name:    "clearly better",
+			collect: map[string]ActionData{ActionTurnLeft: simulated(100, 100, 50), ActionTurnRight: simulated(100, 0, 5)},
+			minRuns: 100,
+			action:  ActionTurnLeft,
+			ok:      true,
+		},
+		{
+			name:    "overlapping win chances",
+			collect: map[string]ActionData{ActionTurnLeft: simulated(500, 260, 20, 40), ActionTurnRight: simulated(500, 250, 20, 40)},
+			minRuns: 100,
+		},
+		{
+			name:    "same win chance, longer survival",
+			collect: map[string]ActionData{ActionNOOP: simulated(500, 0, 40, 60), ActionFaster: simulated(500, 0, 5, 15)},
+			minRuns: 100,
+			action:  ActionNOOP,
+			ok:      true,
+		},
+		{
+			name:    "same win chance, overlapping survival",
+			collect: map[string]ActionData{ActionNOOP: simulated(500, 0, 10, 30), ActionFaster: simulated(500, 0, 9, 29)},
+			minRuns: 100,
+		},
+		{
+			name:    "better win chance, shorter survival",
+			collect: map[string]ActionData{ActionNOOP: simulated(500, 400, 10), ActionFaster: simulated(500, 10, 60)},
+			minRuns: 100,
+			action:  ActionNOOP,
+			ok:      true,
+		},
+		{
+			name:    "unsimulated actions are ignored",
+			collect: map[string]ActionData{ActionTurnLeft: simulated(100, 100, 50), ActionSlower: {}},
+			minRuns: 100,
+			action:  ActionTurnLeft,
+			ok:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gd := GameData{Collect: tt.collect}
+			action, ok := gd.dominant(tt.minRuns)
+			if action != tt.action || ok != tt.ok {
+				t.Errorf("dominant(%d) = %s, %t, want %s, %t", tt.minRuns, action, ok, tt.action, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+// trainSample is a single decision of a player: the features of all legal actions and the index of the action taken.
+type trainSample struct {
+	features [][]float64
+	label    int
+}
+
+// samplesFromRecord returns the decisions of all players in a record.
+// Only decisions after which the player survived at least horizon rounds or won the game are used.
+func samplesFromRecord(r *GameRecord, horizon int) ([]trainSample, error) {
+	states, err := r.replay()
+	if err != nil {
+		return nil, err
+	}
+	final := states[len(states)-1]
+
+	var samples []trainSample
+	for i, round := range r.Rounds {
+		for k, a := range round.Actions {
+			if a == "" {
+				continue
+			}
+			if j := i + 1 + horizon; j < len(states) {
+				if !states[j].Players[k].Active {
+					continue
+				}
+			} else if !final.Players[k].Active {
+				continue
+			}
+
+			g := states[i].PublicCopy()
+			g.You = k
+			actions, features := g.learnedActionFeatures()
+			for l := range actions {
+				if actions[l] == a {
+					samples = append(samples, trainSample{features: features, label: l})
+					break
+				}
+			}
+		}
+	}
+	return samples, nil
+}
+
+// selfPlayRecord plays a local game in which every player uses a random AI out of teachers and returns its record.
+func selfPlayRecord(size, players int, teachers []string) (*GameRecord, error) {
+	g := newGame(size, size, players)
+	for k := range g.Players {
+		g.Players[k].ai = NewAI(teachers[rand.Intn(len(teachers))])
+	}
+	states := []*Game{g.PublicCopy()}
+	for g.Running {
+		g.advance()
+		states = append(states, g.PublicCopy())
+	}
+	return newGameRecord(states, 1)
+}
+
+// loadTrainRecord reads a record (see 'sl_ow record') or converts a dump (see -dump) into a record.
+func loadTrainRecord(file string) (*GameRecord, error) {
+	r, err := loadRecord(file)
+	if err == nil {
+		return r, nil
+	}
+	dump, dumpErr := loadDump(file)
+	if dumpErr != nil {
+		return nil, fmt.Errorf("neither record (%s) nor dump (%s)", err, dumpErr)
+	}
+	return recordFromDump(dump)
+}
+
+// evaluateModel returns the mean negative log likelihood and the share of samples in which the action with the highest probability was taken.
+func evaluateModel(m *LearnedModel, samples []trainSample) (float64, float64) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	loss, correct := 0.0, 0
+	for _, s := range samples {
+		p := m.probabilities(s.features)
+		loss -= math.Log(math.Max(p[s.label], 1e-12))
+		best := 0
+		for i := range p {
+			if p[i] > p[best] {
+				best = i
+			}
+		}
+		if best == s.label {
+			correct++
+		}
+	}
+	return loss / float64(len(samples)), float64(correct) / float64(len(samples))
+}
+
+// trainModel fits the weights of m to the samples with stochastic gradient descent on the negative log likelihood with L2 regularisation.
+func trainModel(m *LearnedModel, samples []trainSample, epochs int, rate, l2 float64) {
+	order := rand.Perm(len(samples))
+	for epoch := 0; epoch < epochs; epoch++ {
+		rand.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+		r := rate / (1 + float64(epoch)/10)
+		for _, o := range order {
+			s := samples[o]
+			p := m.probabilities(s.features)
+			for w := range m.Weights {
+				// Gradient of the log likelihood: observed minus expected feature
+				g := s.features[s.label][w]
+				for i := range p {
+					g -= p[i] * s.features[i][w]
+				}
+				m.Weights[w] += r * (g - l2*m.Weights[w])
+			}
+		}
+	}
+}
+
+// trainCommand trains the model of LearnedAI from game records, dumps and self-play games.
+func trainCommand(args []string) {
+	fs := flag.NewFlagSet("train", flag.ExitOnError)
+	out := fs.String("out", "model.json", "File the model is written to")
+	start := fs.String("model", "", "Start with the model from this file instead of zero weights")
+	selfPlay := fs.Int("selfplay", 0, "Number of self-play games added to the training data")
+	size := fs.Int("size", 40, "Width and height of the self-play games")
+	players := fs.Int("players", 4, "Number of players of the self-play games")
+	teachers := fs.String("teachers", "LargestFreeAI,JumpingLargestFreeAI,SuperSnailAI,SnailAI", "Comma separated list of AIs used in the self-play games")
+	horizon := fs.Int("horizon", 10, "Only learn decisions after which the player survived this number of rounds or won")
+	epochs := fs.Int("epochs", 20, "Number of passes over the training data")
+	rate := fs.Float64("rate", 0.05, "Learning rate")
+	l2 := fs.Float64("l2", 0.0001, "L2 regularisation")
+	validation := fs.Float64("validation", 0.1, "Share of the games used for validation")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "Seed for the self-play games and the training")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: sl_ow train [flags] [record or dump files]")
+		fmt.Fprintln(fs.Output(), "Trains the model of LearnedAI to imitate the surviving players of the given games and of self-play games.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 && *selfPlay <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *size < 2 || *players < 2 || *players > MaxPlayers || *epochs < 1 || *horizon < 0 || *validation < 0 || *validation >= 1 {
+		log.Fatalln("size and players must be at least 2, players at most", MaxPlayers, ", epochs at least 1, horizon not negative and validation in [0, 1)")
+	}
+	teacherList := strings.Split(*teachers, ",")
+	for _, t := range teacherList {
+		if NewAI(t) == nil {
+			log.Fatalln("unknown ai", t, "(available:", strings.Join(AINames(), ", ")+")")
+		}
+	}
+
+	m := &LearnedModel{Features: learnedFeatures, Weights: make([]float64, len(learnedFeatures))}
+	if *start != "" {
+		var err error
+		m, err = loadLearnedModel(*start)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	rand.Seed(*seed)
+	var records []*GameRecord
+	for _, file := range fs.Args() {
+		r, err := loadTrainRecord(file)
+		if err != nil {
+			log.Fatalln(file+":", err)
+		}
+		records = append(records, r)
+	}
+	for i := 0; i < *selfPlay; i++ {
+		r, err := selfPlayRecord(*size, *players, teacherList)
+		if err != nil {
+			log.Fatalln("self-play:", err)
+		}
+		records = append(records, r)
+	}
+
+	// Split by game so that validation positions are not correlated with training positions
+	var train, validate []trainSample
+	for _, r := range records {
+		samples, err := samplesFromRecord(r, *horizon)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if rand.Float64() < *validation {
+			validate = append(validate, samples...)
+		} else {
+			train = append(train, samples...)
+		}
+	}
+	fmt.Printf("%d games, %d training and %d validation decisions\n", len(records), len(train), len(validate))
+	if len(train) == 0 {
+		log.Fatalln("no training data")
+	}
+
+	loss, accuracy := evaluateModel(m, train)
+	fmt.Printf("start: loss %.3f, accuracy %.3f\n", loss, accuracy)
+	trainModel(m, train, *epochs, *rate, *l2)
+	loss, accuracy = evaluateModel(m, train)
+	fmt.Printf("training: loss %.3f, accuracy %.3f\n", loss, accuracy)
+	if len(validate) > 0 {
+		loss, accuracy = evaluateModel(m, validate)
+		fmt.Printf("validation: loss %.3f, accuracy %.3f\n", loss, accuracy)
+	}
+
+	fmt.Println()
+	for i := range m.Features {
+		fmt.Printf("%-20s %8.3f\n", m.Features[i], m.Weights[i])
+	}
+
+	err := saveLearnedModel(*out, m)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
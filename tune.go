@@ -0,0 +1,284 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// tuneDimension describes a single tunable parameter.
+// During tuning, all values are normalised to [0, 1].
+type tuneDimension struct {
+	Name     string
+	Min, Max float64
+	Integer  bool
+	Rollouts []string // Rollout AIs using the parameter, nil if it is used by the engine itself
+	Get      func(p *Parameters) float64
+	Set      func(p *Parameters, v float64)
+}
+
+// tuneDimensions holds all parameters optimised by the tune command.
+var tuneDimensions = []tuneDimension{
+	{
+		Name: "winThreshold", Min: 0.5, Max: 1,
+		Get: func(p *Parameters) float64 { return p.WinThreshold },
+		Set: func(p *Parameters, v float64) { p.WinThreshold = v },
+	},
+	{
+		Name: "winGate", Min: 0, Max: 0.5,
+		Get: func(p *Parameters) float64 { return p.WinGate },
+		Set: func(p *Parameters, v float64) { p.WinGate = v },
+	},
+	{
+		Name: "jumpAITries", Min: 10, Max: 1000, Integer: true,
+		Rollouts: []string{"JumpAI", "JumpingLargestFreeAI", "JumpingSnailAI"},
+		Get:      func(p *Parameters) float64 { return float64(p.JumpAITries) },
+		Set:      func(p *Parameters, v float64) { p.JumpAITries = int(v) },
+	},
+	{
+		Name: "jumpingLargestFreeAIJumpAtLessThanFree", Min: 5, Max: 200, Integer: true,
+		Rollouts: []string{"JumpingLargestFreeAI"},
+		Get:      func(p *Parameters) float64 { return float64(p.JumpingLargestFreeAIJumpAtLessThanFree) },
+		Set:      func(p *Parameters, v float64) { p.JumpingLargestFreeAIJumpAtLessThanFree = int(v) },
+	},
+	{
+		Name: "metaAISwitchProbability", Min: 0, Max: 0.5,
+		Rollouts: []string{"MetaAI"},
+		Get:      func(p *Parameters) float64 { return p.MetaAISwitchProbability },
+		Set:      func(p *Parameters, v float64) { p.MetaAISwitchProbability = v },
+	},
+	{
+		Name: "exploration", Min: 0, Max: 2,
+		Get: func(p *Parameters) float64 { return p.Exploration },
+		Set: func(p *Parameters, v float64) { p.Exploration = v },
+	},
+}
+
+// tuneOptions holds the settings of the local games used for tuning.
+type tuneOptions struct {
+	Size    int
+	Players int
+	Budget  time.Duration
+	Workers int
+	Rollout string
+}
+
+// activeTuneDimensions returns the dimensions which have an effect with the given rollout AI.
+// Parameters of AIs only matter in the simulations since the opponents of the tuning games always use DefaultParameters.
+func activeTuneDimensions(rollout string) []tuneDimension {
+	var dims []tuneDimension
+	for _, d := range tuneDimensions {
+		if d.Rollouts == nil {
+			dims = append(dims, d)
+			continue
+		}
+		for _, r := range d.Rollouts {
+			if r == rollout {
+				dims = append(dims, d)
+				break
+			}
+		}
+	}
+	return dims
+}
+
+// normaliseParameters converts the dimensions of parameters into a vector in [0, 1].
+func normaliseParameters(dims []tuneDimension, p Parameters) []float64 {
+	theta := make([]float64, len(dims))
+	for i, d := range dims {
+		theta[i] = (d.Get(&p) - d.Min) / (d.Max - d.Min)
+		theta[i] = math.Max(0, math.Min(1, theta[i]))
+	}
+	return theta
+}
+
+// denormaliseParameters converts a vector in [0, 1] back into parameters. Parameters not in dims are taken from base.
+func denormaliseParameters(dims []tuneDimension, base Parameters, theta []float64) Parameters {
+	p := base
+	for i, d := range dims {
+		v := d.Min + math.Max(0, math.Min(1, theta[i]))*(d.Max-d.Min)
+		if d.Integer {
+			v = math.Round(v)
+		}
+		d.Set(&p, v)
+	}
+	return p
+}
+
+// playTuneGame plays a local game in which player 1 uses the engine with the given parameters and all other players use AIs out of the rotation.
+// The opponents always use DefaultParameters.
+// The score is 1 for a win, otherwise it is the share of opponents which crashed before player 1 scaled to [0, 0.5].
+func playTuneGame(p Parameters, seed int64, opts tuneOptions) float64 {
+	rand.Seed(seed)
+	g := newGame(opts.Size, opts.Size, opts.Players)
+	for k := range g.Players {
+		g.Players[k].ai = GetAI()
+	}
+	g.Players[1].ai = &EngineAI{
+		Engine: &Engine{Workers: opts.Workers, Rollout: opts.Rollout, Parameters: &p},
+		Budget: opts.Budget,
+	}
+
+	for g.Running && g.Players[1].Active {
+		g.advance()
+	}
+
+	if g.Players[1].Active {
+		return 1
+	}
+	if opts.Players < 2 {
+		return 0
+	}
+	dead := 0
+	for k := range g.Players {
+		if k != 1 && !g.Players[k].Active {
+			dead++
+		}
+	}
+	return 0.5 * float64(dead) / float64(opts.Players-1)
+}
+
+// evaluateParameters returns the mean score of the parameters over one game per seed.
+func evaluateParameters(p Parameters, seeds []int64, opts tuneOptions) float64 {
+	score := 0.0
+	for _, seed := range seeds {
+		score += playTuneGame(p, seed, opts)
+	}
+	return score / float64(len(seeds))
+}
+
+// tuneCommand optimises the parameters with SPSA (simultaneous perturbation stochastic approximation) using local games.
+func tuneCommand(args []string) {
+	fs := flag.NewFlagSet("tune", flag.ExitOnError)
+	out := fs.String("out", "parameters.json", "File the best parameters are written to")
+	start := fs.String("params", "", "Start with the parameters from this file instead of the defaults")
+	iterations := fs.Int("iterations", 50, "Number of SPSA iterations")
+	games := fs.Int("games", 10, "Number of games per evaluation")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "Seed for the games")
+	a := fs.Float64("a", 0.05, "SPSA step size")
+	c := fs.Float64("c", 0.1, "SPSA perturbation size")
+	size := fs.Int("size", 40, "Width and height of the local games")
+	players := fs.Int("players", 4, "Number of players of the local games")
+	budget := fs.Duration("budget", 200*time.Millisecond, "Computation time of the engine per round")
+	workers := fs.Int("workers", runtime.NumCPU(), "Number of simulation workers")
+	rollout := fs.String("rollout", "", "AI used in the simulations (default SuperRandomAI)")
+	fs.Parse(args)
+
+	if *iterations < 1 || *games < 1 || *workers < 1 || *players < 2 || *players > MaxPlayers || *size < 2 {
+		log.Fatalln("iterations, games and workers must be at least 1, size and players at least 2 and players at most", MaxPlayers)
+	}
+	if *rollout != "" && NewAI(*rollout) == nil {
+		log.Fatalln("unknown rollout ai", *rollout)
+	}
+
+	opts := tuneOptions{
+		Size:    *size,
+		Players: *players,
+		Budget:  *budget,
+		Workers: *workers,
+		Rollout: *rollout,
+	}
+
+	initial := DefaultParameters
+	if *start != "" {
+		var err error
+		initial, err = loadParameters(*start)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	seeds := rand.New(rand.NewSource(*seed))
+	nextSeeds := func() []int64 {
+		s := make([]int64, *games)
+		for i := range s {
+			s[i] = seeds.Int63()
+		}
+		return s
+	}
+
+	dims := activeTuneDimensions(*rollout)
+	names := make([]string, len(dims))
+	for i := range dims {
+		names[i] = dims[i].Name
+	}
+	fmt.Println("tuning", strings.Join(names, ", "))
+	theta := normaliseParameters(dims, initial)
+	stability := float64(*iterations) / 10
+
+	for k := 0; k < *iterations; k++ {
+		ak := *a / math.Pow(float64(k+1)+stability, 0.602)
+		ck := *c / math.Pow(float64(k+1), 0.101)
+
+		delta := make([]float64, len(theta))
+		plus := make([]float64, len(theta))
+		minus := make([]float64, len(theta))
+		for i := range theta {
+			delta[i] = 1
+			if seeds.Intn(2) == 0 {
+				delta[i] = -1
+			}
+			plus[i] = theta[i] + ck*delta[i]
+			minus[i] = theta[i] - ck*delta[i]
+		}
+
+		// Same seeds for both evaluations to reduce the variance
+		s := nextSeeds()
+		fPlus := evaluateParameters(denormaliseParameters(dims, initial, plus), s, opts)
+		fMinus := evaluateParameters(denormaliseParameters(dims, initial, minus), s, opts)
+
+		for i := range theta {
+			theta[i] += ak * (fPlus - fMinus) / (2 * ck * delta[i])
+			theta[i] = math.Max(0, math.Min(1, theta[i]))
+		}
+
+		current := denormaliseParameters(dims, initial, theta)
+		b, _ := json.Marshal(current)
+		fmt.Printf("iteration %d/%d: score+ %.3f score- %.3f %s\n", k+1, *iterations, fPlus, fMinus, b)
+
+		// Save progress so that long runs can be interrupted
+		err := saveParameters(*out, current)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	// Validate against the start since SPSA might have drifted on noise
+	s := nextSeeds()
+	final := denormaliseParameters(dims, initial, theta)
+	fFinal := evaluateParameters(final, s, opts)
+	fInitial := evaluateParameters(initial, s, opts)
+	fmt.Printf("validation: tuned %.3f start %.3f\n", fFinal, fInitial)
+
+	best := final
+	if fInitial > fFinal {
+		fmt.Println("start parameters are better, keeping them")
+		best = initial
+	}
+	err := saveParameters(*out, best)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Println("parameters written to", *out)
+}
@@ -21,14 +21,12 @@ import (
 	"time"
 )
 
-var colours = []string{"\033[39m", "\033[31m", "\033[32m", "\033[33m", "\033[34m", "\033[35m", "\033[36m"}
-var colourReset = "\033[0m"
-
 // The UI interface allows the usage of different UIs in sl_ow.
 type UI interface {
 	Initialise() error
 	NewRound(g *Game, round int)
 	NewData(data GameData)
+	Progress(p ProgressData)
 	Finish(won bool, survived, round int) error
 	Wait()
 }
@@ -43,14 +41,18 @@ func buildGameOverviewStrings(gd GameData, round, rounds int, detailled bool) []
 	var sb strings.Builder
 
 	sb.WriteString("alive: [ ")
-	for i := 1; i <= 6; i++ {
-		if g.Players[i] == nil {
-			break
-		} else if g.Players[i].Active {
+	for n, i := range g.playerIDs() {
+		if n > 0 && n%10 == 0 {
+			// Keep the line short for many players
+			ss = append(ss, sb.String())
+			sb.Reset()
+			sb.WriteString("       ")
+		}
+		if g.Players[i].Active {
 			if i == g.You {
 				sb.WriteRune('>')
 			}
-			sb.WriteRune(rune(48 + i))
+			sb.WriteRune(playerRune(i))
 			if i == g.You {
 				sb.WriteRune('<')
 			}
@@ -72,30 +74,38 @@ func buildGameOverviewStrings(gd GameData, round, rounds int, detailled bool) []
 	ss = append(ss, fmt.Sprintf("size: %d x %d", gd.Game.Width, gd.Game.Height))
 	ss = append(ss, fmt.Sprintf("usage: %.2f", 1.0-gd.Game.usage(0)))
 	ss = append(ss, fmt.Sprintf("runtime: %s", gd.Runtime.Truncate(1*time.Second).String()))
+	ss = append(ss, fmt.Sprintf("config: %s", gd.Config))
 
 	if gd.Alive {
 		ss = append(ss, "")
 		ss = append(ss, fmt.Sprintf("speed: %d", g.Players[g.You].Speed))
 		ss = append(ss, fmt.Sprintf("jumps: %d", gd.Jumps))
+		ss = append(ss, fmt.Sprintf("pondered: %d", gd.Pondered))
+		ss = append(ss, fmt.Sprintf("early stop: %t", gd.EarlyStop))
 		ss = append(ss, "")
 		for _, action := range []string{ActionNOOP, ActionSlower, ActionFaster, ActionTurnLeft, ActionTurnRight} {
-			ss = append(ss, fmt.Sprintf("%s:", action))
-			ss = append(ss, fmt.Sprintf("   win chance: %.2f", float64(gd.Collect[action].Won)/float64(gd.Collect[action].Run)))
+			ss = append(ss, fmt.Sprintf("%s (%s):", action, gd.Safety[action]))
+			winLow, winHigh := gd.Collect[action].WinInterval()
+			ss = append(ss, fmt.Sprintf("   win chance: %.2f [%.2f, %.2f]", gd.Collect[action].WinChance(), winLow, winHigh))
 			ss = append(ss, fmt.Sprintf("   run: %d", gd.Collect[action].Run))
 			ss = append(ss, fmt.Sprintf("   won: %d", gd.Collect[action].Won))
 			ss = append(ss, fmt.Sprintf("   survived: %d", gd.Collect[action].Survived))
 			ss = append(ss, fmt.Sprintf("   round: %d", gd.Collect[action].Round))
-			ss = append(ss, fmt.Sprintf("   average length: %.1f", float64(gd.Collect[action].Survived)/float64(gd.Collect[action].Run)))
+			lengthLow, lengthHigh := gd.Collect[action].LengthInterval()
+			ss = append(ss, fmt.Sprintf("   average length: %.1f [%.1f, %.1f]", gd.Collect[action].AverageLength(), lengthLow, lengthHigh))
 			if detailled {
 				ss = append(ss, fmt.Sprintf("   average length best opponent: %.1f", float64(gd.Collect[action].SurvivdedOpponent)/float64(gd.Collect[action].Run)))
-				if len(gd.Collect[action].SurvivedList) == 0 {
+				survival := gd.Collect[action].Survival
+				if survival.Total == 0 {
 					ss = append(ss, fmt.Sprintf("   1st quantile length not available"))
 					ss = append(ss, fmt.Sprintf("   median length not available"))
 					ss = append(ss, fmt.Sprintf("   3rd quantile length not available"))
+					ss = append(ss, fmt.Sprintf("   survival not available"))
 				} else {
-					ss = append(ss, fmt.Sprintf("   1st quantile length: %d", gd.Collect[action].SurvivedList[len(gd.Collect[action].SurvivedList)/4]))
-					ss = append(ss, fmt.Sprintf("   median length: %d", gd.Collect[action].SurvivedList[len(gd.Collect[action].SurvivedList)/2]))
-					ss = append(ss, fmt.Sprintf("   3rd quantile length: %d", gd.Collect[action].SurvivedList[len(gd.Collect[action].SurvivedList)/4*3]))
+					ss = append(ss, fmt.Sprintf("   1st quantile length: %d", survival.Quantile(0.25)))
+					ss = append(ss, fmt.Sprintf("   median length: %d", survival.Quantile(0.5)))
+					ss = append(ss, fmt.Sprintf("   3rd quantile length: %d", survival.Quantile(0.75)))
+					ss = append(ss, fmt.Sprintf("   survival 10/25/50/100: %.2f %.2f %.2f %.2f", survival.Survival(10), survival.Survival(25), survival.Survival(50), survival.Survival(100)))
 				}
 			}
 		}
@@ -104,11 +114,12 @@ func buildGameOverviewStrings(gd GameData, round, rounds int, detailled bool) []
 		ss = append(ss, "")
 		ss = append(ss, fmt.Sprintf("selected: %s", gd.Action))
 		ss = append(ss, fmt.Sprintf("reason: %s", gd.Reason))
+		ss = append(ss, fmt.Sprintf("indistinguishable: %s", strings.Join(gd.Ties, " ")))
 		ss = append(ss, "")
 	} else {
-		empty := 13*5 + 10
+		empty := 13*5 + 13
 		if detailled {
-			empty += 4 * 5
+			empty += 5 * 5
 		}
 		for i := 0; i < empty; i++ {
 			ss = append(ss, "")
@@ -116,3 +127,46 @@ func buildGameOverviewStrings(gd GameData, round, rounds int, detailled bool) []
 	}
 	return ss
 }
+
+// buildProgressString returns a single line describing the progress.
+func buildProgressString(p ProgressData) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("thinking %.1fs", p.Elapsed.Seconds()))
+	if p.Available > 0 {
+		sb.WriteString(fmt.Sprintf("/%.1fs", p.Available.Seconds()))
+	}
+	sb.WriteString(" runs:")
+	for _, action := range []string{ActionNOOP, ActionSlower, ActionFaster, ActionTurnLeft, ActionTurnRight} {
+		sb.WriteString(fmt.Sprintf(" %d", p.Runs[action]))
+	}
+	sb.WriteString(fmt.Sprintf(" leader: %s", p.Leader))
+	return sb.String()
+}
+
+// buildOpponentStrings returns a panel per opponent.
+func buildOpponentStrings(gd GameData) []string {
+	if gd.Game == nil {
+		return nil
+	}
+	ss := make([]string, 0, 1+8*len(gd.Opponents))
+	ss = append(ss, fmt.Sprintf("own territory: %d", gd.Territory))
+	for _, o := range gd.Opponents {
+		ss = append(ss, "")
+		name := o.Name
+		if name == "" {
+			name = "unknown"
+		}
+		ss = append(ss, fmt.Sprintf("player %d: %s", o.ID, name))
+		if !o.Active {
+			ss = append(ss, "   dead")
+			continue
+		}
+		ss = append(ss, fmt.Sprintf("   speed: %d", o.Speed))
+		ss = append(ss, fmt.Sprintf("   direction: %s", o.Direction))
+		ss = append(ss, fmt.Sprintf("   territory: %d", o.Territory))
+		ss = append(ss, fmt.Sprintf("   distance: %d", o.Distance))
+		ss = append(ss, fmt.Sprintf("   actions: %s", strings.Join(o.Actions, " ")))
+		ss = append(ss, fmt.Sprintf("   jumps: %d", o.Jumps))
+	}
+	return ss
+}
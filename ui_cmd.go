@@ -17,10 +17,18 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"strings"
 )
 
 type cmdUI struct {
+	progress bool // Show the progress line, which is only useful in a terminal
+}
+
+// isTerminal returns whether f is a terminal and not e.g. a pipe or a file.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
 }
 
 func (c cmdUI) Initialise() error {
@@ -33,12 +41,10 @@ func (c cmdUI) NewRound(g *Game, round int) {
 	fmt.Println(g.PrintGame(true))
 	fmt.Println()
 
-	fmt.Printf("Round %d - You: %s%d%s (alive: [ ", round, colours[g.You], g.You, colourReset)
-	for i := 1; i <= 6; i++ {
-		if g.Players[i] == nil {
-			break
-		} else if g.Players[i].Active {
-			fmt.Print(colours[i])
+	fmt.Printf("Round %d - You: %s%d%s (alive: [ ", round, playerColour(g.You), g.You, colourReset)
+	for _, i := range g.playerIDs() {
+		if g.Players[i].Active {
+			fmt.Print(playerColour(i))
 			if i == g.You {
 				fmt.Print("\033[4m")
 			}
@@ -46,7 +52,7 @@ func (c cmdUI) NewRound(g *Game, round int) {
 			fmt.Print(colourReset)
 			fmt.Print(" ")
 		} else {
-			fmt.Print(colours[0])
+			fmt.Print(playerColour(0))
 			fmt.Print("⬜ ")
 			fmt.Print(colourReset)
 		}
@@ -60,7 +66,7 @@ func (c cmdUI) NewData(data GameData) {
 	for i := range ss {
 		if strings.TrimSpace(ss[i]) != "" {
 			if i == 0 {
-				ss[i] = fmt.Sprintf("%-50s", ss[i])
+				ss[i] = fmt.Sprintf("%-50s\033[K", ss[i])
 			}
 			fmt.Println(ss[i])
 		}
@@ -68,6 +74,13 @@ func (c cmdUI) NewData(data GameData) {
 	fmt.Println()
 }
 
+func (c cmdUI) Progress(p ProgressData) {
+	if !c.progress {
+		return
+	}
+	fmt.Printf("%s\033[K\r", buildProgressString(p))
+}
+
 func (c cmdUI) Finish(won bool, survived, round int) error {
 	if won {
 		fmt.Printf("\nWin!\n\n")
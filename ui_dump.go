@@ -44,6 +44,12 @@ func (d *dumpUI) NewData(data GameData) {
 	}
 }
 
+func (d *dumpUI) Progress(p ProgressData) {
+	if d.UI != nil {
+		d.UI.Progress(p)
+	}
+}
+
 func (d *dumpUI) Finish(won bool, survived, round int) error {
 	var err error
 	if d.UI != nil {
@@ -74,3 +80,31 @@ func (d *dumpUI) Wait() {
 		d.UI.Wait()
 	}
 }
+
+// loadDump reads all game states written by dumpUI.
+// Since private fields are not part of the dump, the step counters are restored from the round.
+func loadDump(file string) ([]GameData, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var gameStates []GameData
+	err = gob.NewDecoder(f).Decode(&gameStates)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range gameStates {
+		g := gameStates[i].Game
+		if g == nil {
+			continue
+		}
+		for k := range g.Players {
+			g.Players[k].stepCounter = gameStates[i].Round - 1
+		}
+		g.PopulateInternalCellsFlat()
+	}
+	return gameStates, nil
+}
@@ -0,0 +1,197 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// logEvent is a single line of the structured log.
+type logEvent struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"` // "round" or "finish"
+	Config string    `json:"config,omitempty"`
+
+	// Round events
+	Round      int                  `json:"round,omitempty"`
+	Alive      bool                 `json:"alive"`
+	Deadline   *time.Time           `json:"deadline,omitempty"`
+	ThinkingMs float64              `json:"thinkingMs,omitempty"`
+	Opponents  *int                 `json:"opponentsAlive,omitempty"`
+	Action     string               `json:"action,omitempty"`
+	Reason     string               `json:"reason,omitempty"`
+	Pondered   int                  `json:"pondered,omitempty"`
+	Actions    map[string]logAction `json:"actions,omitempty"`
+	Ties       []string             `json:"indistinguishable,omitempty"`
+	EarlyStop  bool                 `json:"earlyStop,omitempty"`
+
+	// Finish events
+	Won      bool `json:"won"`
+	Survived int  `json:"survived,omitempty"`
+	Rounds   int  `json:"rounds,omitempty"`
+}
+
+// logAction holds the statistics of a single action.
+type logAction struct {
+	Safety       string          `json:"safety"`
+	Run          int             `json:"run"`
+	Won          int             `json:"won"`
+	WinRate      float64         `json:"winRate"`
+	WinRateCI    [2]float64      `json:"winRateCI"`
+	MeanSurvival float64         `json:"meanSurvival"`
+	MeanCI       [2]float64      `json:"meanSurvivalCI"`
+	Q1Survival   int             `json:"q1Survival"`
+	Median       int             `json:"medianSurvival"`
+	Q3Survival   int             `json:"q3Survival"`
+	Curve        []SurvivalPoint `json:"survivalCurve,omitempty"`
+}
+
+// logUI writes one JSON event per round and one at the end of the game.
+// If File is "-", the events are written to stderr.
+type logUI struct {
+	File string
+	UI   UI
+
+	w      io.Writer
+	f      *os.File
+	enc    *json.Encoder
+	config string
+}
+
+func (l *logUI) Initialise() error {
+	if l.enc != nil {
+		return fmt.Errorf("log already opened")
+	}
+	if l.File == "-" {
+		l.w = os.Stderr
+	} else {
+		var err error
+		l.f, err = os.Create(l.File)
+		if err != nil {
+			l.f = nil
+			return err
+		}
+		l.w = l.f
+	}
+	l.enc = json.NewEncoder(l.w)
+	if l.UI != nil {
+		return l.UI.Initialise()
+	}
+	return nil
+}
+
+func (l *logUI) NewRound(g *Game, round int) {
+	if l.UI != nil {
+		l.UI.NewRound(g, round)
+	}
+}
+
+func (l *logUI) NewData(data GameData) {
+	if l.enc != nil && data.Game != nil {
+		l.config = data.Config
+		e := logEvent{
+			Time:     time.Now(),
+			Event:    "round",
+			Config:   data.Config,
+			Round:    data.Round,
+			Alive:    data.Alive,
+			Pondered: data.Pondered,
+		}
+		opponents := 0
+		for k := range data.Game.Players {
+			if k != data.Game.You && data.Game.Players[k].Active {
+				opponents++
+			}
+		}
+		e.Opponents = &opponents
+		if data.Alive {
+			if !data.Deadline.IsZero() {
+				deadline := data.Deadline
+				e.Deadline = &deadline
+			}
+			e.ThinkingMs = float64(data.Thinking) / float64(time.Millisecond)
+			e.Action = data.Action
+			e.Reason = data.Reason
+			e.Ties = data.Ties
+			e.EarlyStop = data.EarlyStop
+			e.Actions = make(map[string]logAction, len(data.Collect))
+			for k, d := range data.Collect {
+				a := logAction{Safety: data.Safety[k].String(), Run: d.Run, Won: d.Won}
+				if d.Run > 0 {
+					a.WinRate = float64(d.Won) / float64(d.Run)
+					a.MeanSurvival = float64(d.Survived) / float64(d.Run)
+				}
+				a.WinRateCI[0], a.WinRateCI[1] = d.WinInterval()
+				if d.Run > 1 {
+					a.MeanCI[0], a.MeanCI[1] = d.LengthInterval()
+				}
+				a.Q1Survival, a.Median, a.Q3Survival = d.Survival.Quantile(0.25), d.Survival.Quantile(0.5), d.Survival.Quantile(0.75)
+				a.Curve = d.Survival.Curve()
+				e.Actions[k] = a
+			}
+		}
+		l.enc.Encode(e)
+	}
+
+	if l.UI != nil {
+		l.UI.NewData(data)
+	}
+}
+
+func (l *logUI) Progress(p ProgressData) {
+	if l.UI != nil {
+		l.UI.Progress(p)
+	}
+}
+
+func (l *logUI) Finish(won bool, survived, round int) error {
+	var err error
+	if l.enc != nil {
+		err = l.enc.Encode(logEvent{
+			Time:     time.Now(),
+			Event:    "finish",
+			Config:   l.config,
+			Won:      won,
+			Survived: survived,
+			Rounds:   round,
+		})
+		if l.f != nil {
+			closeErr := l.f.Close()
+			if err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if l.UI != nil {
+		newErr := l.UI.Finish(won, survived, round)
+		if newErr != nil && err != nil {
+			return fmt.Errorf("two errors: %s, %s", err.Error(), newErr.Error())
+		} else if newErr != nil {
+			err = newErr
+		}
+	}
+	return err
+}
+
+func (l *logUI) Wait() {
+	if l.UI != nil {
+		l.UI.Wait()
+	}
+}
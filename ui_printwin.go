@@ -43,6 +43,12 @@ func (p *printWinUI) NewData(data GameData) {
 	}
 }
 
+func (p *printWinUI) Progress(pd ProgressData) {
+	if p.UI != nil {
+		p.UI.Progress(pd)
+	}
+}
+
 func (p *printWinUI) Finish(won bool, survived, round int) error {
 	var err error
 	if p.UI != nil {
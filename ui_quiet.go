@@ -28,6 +28,9 @@ func (q quietUI) NewRound(g *Game, round int) {
 func (q quietUI) NewData(data GameData) {
 }
 
+func (q quietUI) Progress(p ProgressData) {
+}
+
 func (q quietUI) Finish(won bool, survived, round int) error {
 	return nil
 }
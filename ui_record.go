@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// recordUI writes a move-by-move record of the game (see GameRecord) into a file.
+type recordUI struct {
+	File   string
+	UI     UI
+	start  int
+	states []*Game
+}
+
+func (r *recordUI) Initialise() error {
+	if r.UI != nil {
+		return r.UI.Initialise()
+	}
+	return nil
+}
+
+func (r *recordUI) NewRound(g *Game, round int) {
+	if r.UI != nil {
+		r.UI.NewRound(g, round)
+	}
+}
+
+func (r *recordUI) NewData(data GameData) {
+	if data.Game != nil {
+		if len(r.states) == 0 {
+			r.start = data.Round
+		}
+		r.states = append(r.states, data.Game.PublicCopy())
+	}
+
+	if r.UI != nil {
+		r.UI.NewData(data)
+	}
+}
+
+func (r *recordUI) Progress(p ProgressData) {
+	if r.UI != nil {
+		r.UI.Progress(p)
+	}
+}
+
+func (r *recordUI) Finish(won bool, survived, round int) error {
+	var err error
+	if r.UI != nil {
+		err = r.UI.Finish(won, survived, round)
+	}
+
+	if len(r.states) == 0 {
+		return err
+	}
+
+	record, newErr := newGameRecord(r.states, r.start)
+	if newErr != nil {
+		return newErr
+	}
+	newErr = writeRecord(r.File, record)
+	if newErr != nil {
+		return newErr
+	}
+
+	return err
+}
+
+func (r *recordUI) Wait() {
+	if r.UI != nil {
+		r.UI.Wait()
+	}
+}
@@ -21,9 +21,10 @@ import (
 )
 
 type teeUI struct {
-	File string
-	UI   UI
-	f    *os.File
+	File   string
+	UI     UI
+	Header string // Written at the start of the file if not empty
+	f      *os.File
 }
 
 func (t *teeUI) Initialise() error {
@@ -36,6 +37,10 @@ func (t *teeUI) Initialise() error {
 		t.f = nil
 		return err
 	}
+	if t.Header != "" {
+		t.f.WriteString(t.Header)
+		t.f.WriteString("\n")
+	}
 	if t.UI != nil {
 		return t.UI.Initialise()
 	}
@@ -69,6 +74,12 @@ func (t *teeUI) NewData(data GameData) {
 	}
 }
 
+func (t *teeUI) Progress(p ProgressData) {
+	if t.UI != nil {
+		t.UI.Progress(p)
+	}
+}
+
 func (t *teeUI) Finish(won bool, survived, round int) error {
 	var err error
 	if t.f != nil {
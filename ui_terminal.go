@@ -23,18 +23,37 @@ import (
 	"github.com/gdamore/tcell"
 )
 
+const (
+	// terminalStatusWidth is the minimal width of the status column.
+	terminalStatusWidth = 45
+	// terminalScrollStep is the number of cells scrolled by H, J, K and L.
+	terminalScrollStep = 10
+)
+
 type terminalUI struct {
-	screen          tcell.Screen
-	gameStates      []GameData
-	gameStateIndex  int
-	colors          map[int]tcell.Color
-	ctx             context.Context
-	done            context.CancelFunc
-	firstGame       chan bool
-	newData         chan GameData
-	running         chan bool
-	positionRunning int
-	once            *sync.Once
+	screen         tcell.Screen
+	gameStates     []GameData
+	gameStateIndex int
+	ctx            context.Context
+	done           context.CancelFunc
+	firstGame      chan bool
+	newData        chan GameData
+	progress       chan ProgressData
+	running        chan bool
+	state          string // Shown in the top line of the status column
+	lastProgress   string
+	once           *sync.Once
+	overlay        int // Index into heatmapLayers, -1 if disabled
+	compact        bool
+	viewX, viewY   int // Top left cell of the viewport
+	statusOffset   int // First shown line of the status column
+	showOpponents  bool
+
+	lastHint  string
+	lastInput string
+
+	Replay []GameData  // Shown instead of waiting for a game if not empty
+	Input  chan string // Receives the actions selected with the keyboard if not nil (play mode), unread actions are replaced by newer ones
 }
 
 func (tui *terminalUI) Initialise() error {
@@ -42,6 +61,7 @@ func (tui *terminalUI) Initialise() error {
 
 	tui.firstGame = make(chan bool, 5)
 	tui.newData = make(chan GameData, 5)
+	tui.progress = make(chan ProgressData, 5)
 	tui.running = make(chan bool, 5)
 	tui.ctx, tui.done = context.WithCancel(context.Background())
 	tui.once = new(sync.Once)
@@ -56,21 +76,14 @@ func (tui *terminalUI) Initialise() error {
 		return err
 	}
 
-	tui.colors = map[int]tcell.Color{
-		-1: tcell.ColorBlack,
-		0:  tcell.ColorBlack,
-		1:  tcell.NewRGBColor(178, 24, 24),
-		2:  tcell.NewRGBColor(24, 178, 24),
-		3:  tcell.NewRGBColor(178, 104, 24),
-		4:  tcell.NewRGBColor(24, 24, 178),
-		5:  tcell.NewRGBColor(178, 24, 178),
-		6:  tcell.NewRGBColor(24, 178, 178),
+	tui.overlay = -1
+	tui.state = "ready"
+	if len(tui.Replay) > 0 {
+		tui.gameStates = tui.Replay
+		tui.firstGame = nil
+		tui.state = "replay"
 	}
-
-	tui.drawString(0, 0, "Waiting for game")
-	tui.positionRunning = FieldMaxSize + 2 + 30
-	tui.drawString(tui.positionRunning, 0, "ready")
-	tui.screen.Show()
+	tui.draw()
 
 	go tui.mainLoop()
 
@@ -93,6 +106,13 @@ func (tui *terminalUI) NewData(data GameData) {
 	}
 }
 
+func (tui *terminalUI) Progress(p ProgressData) {
+	select {
+	case tui.progress <- p:
+	default:
+	}
+}
+
 func (tui *terminalUI) Finish(won bool, survived, round int) error {
 	select {
 	case tui.running <- false:
@@ -105,43 +125,197 @@ func (tui *terminalUI) Wait() {
 	<-tui.ctx.Done()
 }
 
+// drawString draws a single line. Everything outside of the screen is cut off.
 func (tui *terminalUI) drawString(x, y int, v string) {
-	for i, r := range v {
+	w, h := tui.screen.Size()
+	if y < 0 || y >= h {
+		return
+	}
+	i := 0
+	for _, r := range v {
+		if x+i >= w {
+			break
+		}
 		tui.screen.SetContent(x+i, y, r, nil, tcell.StyleDefault)
+		i++
 	}
 }
 
-func (tui *terminalUI) drawGameState() {
-	gd := tui.gameStates[tui.gameStateIndex]
+// layout returns the number of board columns and terminal rows available for the board.
+func (tui *terminalUI) layout(g *Game) (int, int) {
+	w, h := tui.screen.Size()
+	columns := g.Width
+	if columns > w-terminalStatusWidth-1 {
+		columns = w - terminalStatusWidth - 1
+	}
+	if columns < 1 {
+		columns = 1
+	}
+	rows := g.Height
+	if tui.compact {
+		rows = (g.Height + 1) / 2
+	}
+	// Last line is used for the legend
+	if rows > h-1 {
+		rows = h - 1
+	}
+	if rows < 1 {
+		rows = 1
+	}
+	return columns, rows
+}
 
-	g := gd.Game
+// clampViewport keeps the viewport inside of the board.
+func (tui *terminalUI) clampViewport(g *Game) {
+	columns, rows := tui.layout(g)
+	cellRows := rows
+	if tui.compact {
+		cellRows = 2 * rows
+	}
+	if tui.viewX > g.Width-columns {
+		tui.viewX = g.Width - columns
+	}
+	if tui.viewY > g.Height-cellRows {
+		tui.viewY = g.Height - cellRows
+	}
+	if tui.viewX < 0 {
+		tui.viewX = 0
+	}
+	if tui.viewY < 0 {
+		tui.viewY = 0
+	}
+}
+
+// draw redraws the whole screen.
+func (tui *terminalUI) draw() {
+	tui.screen.Clear()
+	defer tui.screen.Show()
 
+	if len(tui.gameStates) == 0 {
+		tui.drawString(0, 0, "Waiting for game")
+		tui.drawString(0, 1, tui.state)
+		tui.drawString(0, 2, tui.lastProgress)
+		return
+	}
+
+	gd := tui.gameStates[tui.gameStateIndex]
+	g := gd.Game
 	if g == nil {
-		tui.screen.Clear()
 		return
 	}
-	for y := 0; y < g.Height; y++ {
-		for x := 0; x < g.Width; x++ {
-			r := g.runeAt(y, x)
-			v := int(g.Cells[y][x])
-			tui.screen.SetContent(x, y, r, nil, tcell.StyleDefault.Foreground(tui.colors[v]))
+
+	var layer []uint32
+	var max uint32
+	legend := "overlay: off (o)"
+	if tui.overlay >= 0 {
+		if gd.Heatmap == nil || gd.Heatmap.Width != g.Width || gd.Heatmap.Height != g.Height {
+			legend = fmt.Sprintf("overlay: %s not recorded (o)", heatmapLayers[tui.overlay])
+		} else {
+			layer = gd.Heatmap.Layer(heatmapLayers[tui.overlay])
+			for _, v := range layer {
+				if v > max {
+					max = v
+				}
+			}
+			legend = fmt.Sprintf("overlay: %s, max %d (o)", heatmapLayers[tui.overlay], max)
 		}
 	}
-	ss := buildGameOverviewStrings(gd, tui.gameStateIndex+1, len(tui.gameStates), false)
-	ox := g.Width + 2
-	for i, s := range ss {
-		if i == 0 {
-			tui.drawString(ox, i, fmt.Sprintf("%-30s", s))
-		} else {
-			tui.drawString(ox, i, fmt.Sprintf("%-100s", s))
+
+	tui.clampViewport(g)
+	columns, rows := tui.layout(g)
+
+	heat := func(x, y int) (tcell.Color, bool) {
+		if layer == nil || max == 0 || layer[y*g.Width+x] == 0 {
+			return tcell.ColorDefault, false
+		}
+		intensity := int32(64 + 191*uint64(layer[y*g.Width+x])/uint64(max))
+		return tcell.NewRGBColor(intensity, intensity/4, 0), true
+	}
+
+	if tui.compact {
+		// Two board rows per line: foreground is the upper cell, background the lower cell
+		for r := 0; r < rows; r++ {
+			for c := 0; c < columns; c++ {
+				x, y := tui.viewX+c, tui.viewY+2*r
+				upper := tui.cellColour(g, x, y)
+				if h, ok := heat(x, y); ok {
+					upper = h
+				}
+				lower := tcell.ColorBlack
+				if y+1 < g.Height {
+					lower = tui.cellColour(g, x, y+1)
+					if h, ok := heat(x, y+1); ok {
+						lower = h
+					}
+				}
+				tui.screen.SetContent(c, r, '▀', nil, tcell.StyleDefault.Foreground(upper).Background(lower))
+			}
+		}
+	} else {
+		for r := 0; r < rows; r++ {
+			for c := 0; c < columns; c++ {
+				x, y := tui.viewX+c, tui.viewY+r
+				style := tcell.StyleDefault.Foreground(playerTerminalColour(int(g.Cells[y][x])))
+				if h, ok := heat(x, y); ok {
+					style = style.Background(h)
+				}
+				tui.screen.SetContent(c, r, g.runeAt(y, x), nil, style)
+			}
 		}
 	}
-	tui.screen.Show()
+
+	mode := "full"
+	if tui.compact {
+		mode = "compact"
+	}
+	tui.drawString(0, rows, fmt.Sprintf("%s - view %d,%d (hjkl) - %s (c)", legend, tui.viewX, tui.viewY, mode))
+
+	// Status column
+	ox := columns + 2
+	_, h := tui.screen.Size()
+	header := []string{tui.state, tui.lastProgress}
+	if tui.Input != nil {
+		header = append(header, tui.lastHint, fmt.Sprintf("input: %s (w/a/s/d, arrows, space; ,/. for history)", tui.lastInput))
+	}
+	for i := range header {
+		tui.drawString(ox, i, header[i])
+	}
+	var ss []string
+	if tui.showOpponents {
+		ss = append([]string{fmt.Sprintf("game state %d/%d - opponents (p)", tui.gameStateIndex+1, len(tui.gameStates))}, buildOpponentStrings(gd)...)
+	} else {
+		ss = buildGameOverviewStrings(gd, tui.gameStateIndex+1, len(tui.gameStates), false)
+	}
+	if tui.statusOffset > len(ss)-1 {
+		tui.statusOffset = len(ss) - 1
+	}
+	if tui.statusOffset < 0 {
+		tui.statusOffset = 0
+	}
+	for i := tui.statusOffset; i < len(ss) && len(header)+i-tui.statusOffset < h; i++ {
+		tui.drawString(ox, len(header)+i-tui.statusOffset, ss[i])
+	}
+}
+
+// cellColour returns the colour of a cell in compact mode.
+func (tui *terminalUI) cellColour(g *Game, x, y int) tcell.Color {
+	v := int(g.Cells[y][x])
+	switch {
+	case v == -1:
+		return tcell.NewRGBColor(128, 128, 128)
+	case v > 0:
+		p := g.Players[v]
+		if p != nil && p.X == x && p.Y == y {
+			// Highlight heads
+			return tcell.ColorWhite
+		}
+	}
+	return playerTerminalColour(v)
 }
 
 func (g *Game) runeAt(y, x int) rune {
 	v := int(g.Cells[y][x])
-	r := rune(48 + v)
+	r := playerRune(v)
 	switch {
 	case v == 0:
 		r = '·'
@@ -182,6 +356,13 @@ func (g *Game) runeAt(y, x int) rune {
 
 func (tui *terminalUI) mainLoop() {
 	running := true
+	quit := func() {
+		tui.screen.Fini()
+		tui.done()
+		if running {
+			fmt.Println("terminal ui closed")
+		}
+	}
 	ec := make(chan tcell.Event, 0)
 	go func() {
 		for {
@@ -194,35 +375,86 @@ func (tui *terminalUI) mainLoop() {
 		select {
 		case e := <-ec:
 			switch ev := e.(type) {
+			case *tcell.EventResize:
+				tui.screen.Sync()
+				tui.draw()
 			case *tcell.EventKey:
+				if tui.Input != nil {
+					if a := playKey(ev); a != "" {
+						sendLatest(tui.Input, a)
+						tui.lastInput = a
+						tui.draw()
+						continue
+					}
+				}
 				switch ev.Key() {
 				case tcell.KeyHome:
 					tui.gameStateIndex = 0
-					tui.drawGameState()
+					tui.draw()
 				case tcell.KeyEnd:
 					tui.gameStateIndex = len(tui.gameStates) - 1
-					tui.drawGameState()
+					tui.draw()
 				case tcell.KeyLeft:
 					if tui.gameStateIndex > 0 {
 						tui.gameStateIndex--
-						tui.drawGameState()
+						tui.draw()
 					}
 				case tcell.KeyRight:
 					if tui.gameStateIndex < len(tui.gameStates)-1 {
 						tui.gameStateIndex++
-						tui.drawGameState()
+						tui.draw()
 					}
+				case tcell.KeyPgUp:
+					tui.statusOffset -= terminalScrollStep
+					tui.draw()
+				case tcell.KeyPgDn:
+					tui.statusOffset += terminalScrollStep
+					tui.draw()
 				case tcell.KeyRune:
-					if ev.Rune() != 'q' {
+					switch ev.Rune() {
+					case 'o':
+						tui.overlay++
+						if tui.overlay >= len(heatmapLayers) {
+							tui.overlay = -1
+						}
+					case 'c':
+						tui.compact = !tui.compact
+					case 'p':
+						tui.showOpponents = !tui.showOpponents
+						tui.statusOffset = 0
+					case 'h':
+						tui.viewX--
+					case 'l':
+						tui.viewX++
+					case 'k':
+						tui.viewY--
+					case 'j':
+						tui.viewY++
+					case 'H':
+						tui.viewX -= terminalScrollStep
+					case 'L':
+						tui.viewX += terminalScrollStep
+					case 'K':
+						tui.viewY -= terminalScrollStep
+					case 'J':
+						tui.viewY += terminalScrollStep
+					case ',':
+						if tui.gameStateIndex > 0 {
+							tui.gameStateIndex--
+						}
+					case '.':
+						if tui.gameStateIndex < len(tui.gameStates)-1 {
+							tui.gameStateIndex++
+						}
+					case 'q':
+						quit()
+						return
+					default:
 						continue
 					}
-					fallthrough
+					tui.draw()
 				case tcell.KeyEscape, tcell.KeyCtrlC:
-					tui.screen.Fini()
-					tui.done()
-					if running {
-						fmt.Println("terminal ui closed")
-					}
+					quit()
 					return
 				}
 			}
@@ -232,17 +464,51 @@ func (tui *terminalUI) mainLoop() {
 				if tui.gameStateIndex == len(tui.gameStates)-2 {
 					tui.gameStateIndex = len(tui.gameStates) - 1
 				}
-				tui.drawGameState()
+				tui.lastProgress = ""
+				tui.lastInput = ""
+				tui.draw()
 			}
+		case p := <-tui.progress:
+			tui.lastProgress = buildProgressString(p)
+			tui.lastHint = buildHintString(p)
+			tui.draw()
 		case _ = <-tui.running:
 			running = false
-			tui.drawString(tui.positionRunning, 0, "finished")
-			tui.screen.Show()
+			tui.state = "finished"
+			tui.draw()
 			tui.running = nil
 		case _ = <-tui.firstGame:
-			tui.drawString(tui.positionRunning, 0, "running")
-			tui.screen.Show()
+			tui.state = "running"
+			tui.draw()
 			tui.firstGame = nil
 		}
 	}
 }
+
+// playKey returns the action selected by a key in play mode or an empty string.
+func playKey(ev *tcell.EventKey) string {
+	switch ev.Key() {
+	case tcell.KeyUp:
+		return ActionFaster
+	case tcell.KeyDown:
+		return ActionSlower
+	case tcell.KeyLeft:
+		return ActionTurnLeft
+	case tcell.KeyRight:
+		return ActionTurnRight
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'w':
+			return ActionFaster
+		case 's':
+			return ActionSlower
+		case 'a':
+			return ActionTurnLeft
+		case 'd':
+			return ActionTurnRight
+		case ' ':
+			return ActionNOOP
+		}
+	}
+	return ""
+}
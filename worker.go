@@ -0,0 +1,384 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// workerFlushInterval is the interval in which a worker sends its results to the coordinator.
+	workerFlushInterval = 50 * time.Millisecond
+	// workerTimeoutMargin is the time a worker stops before the deadline of the coordinator so that its last results still arrive in time.
+	workerTimeoutMargin = 2 * workerFlushInterval
+	// workerMaxTimeout is the maximum simulation time a worker accepts for a single request.
+	workerMaxTimeout = 5 * time.Minute
+	// workerRetryBase is the time a coordinator waits before contacting a failed worker again. It doubles with each failure.
+	workerRetryBase = 1 * time.Second
+	// workerRetryMax is the maximum time a coordinator waits before contacting a failed worker again.
+	workerRetryMax = 1 * time.Minute
+)
+
+// workerRequest is sent by the coordinator to a worker.
+// Timeout is relative so that the clocks of coordinator and worker do not need to be synchronised.
+type workerRequest struct {
+	Game        *Game         `json:"game"`
+	StepCounter map[int]int   `json:"stepCounter"`
+	Timeout     time.Duration `json:"timeout"`
+	Rollout     string        `json:"rollout,omitempty"`
+	Parameters  *Parameters   `json:"parameters,omitempty"`
+	// Profiles are the opponent profiles by player id so that remote rollouts use the same opponent models as local ones.
+	Profiles map[int]*OpponentProfile `json:"profiles,omitempty"`
+}
+
+// workerResult is a single simulation result sent by a worker to the coordinator.
+// It mirrors the result of Game.SimulateGame.
+type workerResult struct {
+	Action            string `json:"action"`
+	Win               bool   `json:"win"`
+	Survived          int    `json:"survived"`
+	SurvivdedOpponent int    `json:"survivdedOpponent"`
+	Round             int    `json:"round"`
+}
+
+// remoteWorker is the coordinator side of a worker process.
+// Failing workers are skipped for an increasing amount of time.
+type remoteWorker struct {
+	l sync.Mutex
+
+	Address  string
+	failures int
+	retry    time.Time
+}
+
+// newRemoteWorkers creates workers for a list of worker addresses.
+func newRemoteWorkers(list []string) []*remoteWorker {
+	var workers []*remoteWorker
+	for _, a := range list {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+		if !strings.HasPrefix(a, "http://") && !strings.HasPrefix(a, "https://") {
+			a = "http://" + a
+		}
+		workers = append(workers, &remoteWorker{Address: strings.TrimSuffix(a, "/")})
+	}
+	return workers
+}
+
+// simulate sends g to the worker and forwards all received results to the channel until the worker closes the stream.
+// The worker stops workerTimeoutMargin before ctxWorker is done, results are read until ctxMain is done.
+func (rw *remoteWorker) simulate(ctxWorker, ctxMain context.Context, g *Game, rollout string, parameters *Parameters, profiles map[int]*OpponentProfile, results chan<- struct {
+	action            string
+	win               bool
+	survived          int
+	survivdedOpponent int
+	round             int
+}) {
+	rw.l.Lock()
+	if time.Now().Before(rw.retry) {
+		rw.l.Unlock()
+		return
+	}
+	rw.l.Unlock()
+
+	deadline, ok := ctxWorker.Deadline()
+	if !ok {
+		// Workers need a deadline
+		return
+	}
+	timeout := time.Until(deadline) - workerTimeoutMargin
+	if timeout <= 0 {
+		return
+	}
+
+	req := workerRequest{
+		Game:        g.PublicCopy(),
+		StepCounter: make(map[int]int, len(g.Players)),
+		Timeout:     timeout,
+		Rollout:     rollout,
+		Parameters:  parameters,
+		Profiles:    profiles,
+	}
+	for k := range g.Players {
+		req.StepCounter[k] = g.Players[k].stepCounter
+	}
+
+	err := rw.stream(ctxMain, req, results)
+	rw.l.Lock()
+	defer rw.l.Unlock()
+	if err != nil {
+		if ctxMain.Err() != nil {
+			// Connection closed due to deadline - not an error of the worker
+			return
+		}
+		rw.failures++
+		wait := workerRetryBase << (rw.failures - 1)
+		if wait > workerRetryMax || wait <= 0 {
+			wait = workerRetryMax
+		}
+		rw.retry = time.Now().Add(wait)
+		log.Printf("worker %s: %s (retry in %s)", rw.Address, err, wait)
+		return
+	}
+	rw.failures = 0
+}
+
+// stream sends the request and forwards the results until the worker closes the stream or ctx is done.
+func (rw *remoteWorker) stream(ctx context.Context, req workerRequest, results chan<- struct {
+	action            string
+	win               bool
+	survived          int
+	survivdedOpponent int
+	round             int
+}) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, rw.Address+"/simulate", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(resp.Body))
+	for dec.More() {
+		var wr workerResult
+		err = dec.Decode(&wr)
+		if err != nil {
+			return err
+		}
+		if !IsValidAction(wr.Action) {
+			return fmt.Errorf("unknown action %s", wr.Action)
+		}
+		select {
+		case results <- struct {
+			action            string
+			win               bool
+			survived          int
+			survivdedOpponent int
+			round             int
+		}{wr.Action, wr.Win, wr.Survived, wr.SurvivdedOpponent, wr.Round}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// workerHandler handles simulation requests of a coordinator.
+type workerHandler struct {
+	engine Engine
+}
+
+func (wh *workerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req workerRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	g := req.Game
+	if g == nil || g.Players[g.You] == nil || len(g.Cells) != g.Height {
+		http.Error(w, "invalid game", http.StatusBadRequest)
+		return
+	}
+	if g.Rules != nil {
+		err = g.Rules.Validate()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	for y := range g.Cells {
+		if len(g.Cells[y]) != g.Width {
+			http.Error(w, "invalid game", http.StatusBadRequest)
+			return
+		}
+	}
+	for k := range g.Players {
+		if k < 1 || k > len(g.Players) {
+			http.Error(w, "invalid player ids", http.StatusBadRequest)
+			return
+		}
+		g.Players[k].stepCounter = req.StepCounter[k]
+		// Active players are simulated and must stand on their own cell
+		p := g.Players[k]
+		if !p.Active {
+			continue
+		}
+		if p.X < 0 || p.X >= g.Width || p.Y < 0 || p.Y >= g.Height || int(g.Cells[p.Y][p.X]) != k {
+			http.Error(w, "invalid player position", http.StatusBadRequest)
+			return
+		}
+		if p.Speed < 1 || p.Speed > g.rules().MaxSpeed {
+			http.Error(w, "invalid player speed", http.StatusBadRequest)
+			return
+		}
+		switch p.Direction {
+		case DirectionUp, DirectionDown, DirectionLeft, DirectionRight:
+		default:
+			http.Error(w, "invalid player direction", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Rollout != "" && aiConstructors[req.Rollout] == nil {
+		http.Error(w, "unknown rollout ai", http.StatusBadRequest)
+		return
+	}
+	if req.Parameters != nil {
+		err = req.Parameters.Validate()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	for k, p := range req.Profiles {
+		if k < 1 || k > len(g.Players) || k == g.You || p == nil {
+			http.Error(w, "invalid profiles", http.StatusBadRequest)
+			return
+		}
+		for speed := range p.Actions {
+			for _, n := range p.Actions[speed] {
+				if n < 0 {
+					http.Error(w, "invalid profiles", http.StatusBadRequest)
+					return
+				}
+			}
+		}
+	}
+	if req.Timeout <= 0 || req.Timeout > workerMaxTimeout {
+		http.Error(w, "invalid timeout", http.StatusBadRequest)
+		return
+	}
+	g.PopulateInternalCellsFlat()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), req.Timeout)
+	defer cancel()
+
+	results := make(chan struct {
+		action            string
+		win               bool
+		survived          int
+		survivdedOpponent int
+		round             int
+	}, wh.engine.Workers)
+	engine := wh.engine
+	engine.Rollout = req.Rollout
+	engine.Parameters = req.Parameters
+	engine.Profiles = req.Profiles
+	done := engine.simulate(ctx, ctx, g, g.Players[g.You].stepCounter+1, nil, results)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	ticker := time.NewTicker(workerFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case res := <-results:
+			err = enc.Encode(workerResult{
+				Action:            res.action,
+				Win:               res.win,
+				Survived:          res.survived,
+				SurvivdedOpponent: res.survivdedOpponent,
+				Round:             res.round,
+			})
+			if err != nil {
+				// Coordinator is gone
+				cancel()
+				drain(results, done)
+				return
+			}
+		case <-ticker.C:
+			flusher.Flush()
+		case <-ctx.Done():
+			flusher.Flush()
+			drain(results, done)
+			return
+		}
+	}
+}
+
+// drain discards all results until done is closed so that no worker blocks.
+func drain(results <-chan struct {
+	action            string
+	win               bool
+	survived          int
+	survivdedOpponent int
+	round             int
+}, done <-chan struct{}) {
+	go func() {
+		for {
+			select {
+			case <-results:
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// workerCommand runs a worker process which simulates games for a coordinator.
+func workerCommand(args []string) {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	listen := fs.String("listen", ":7000", "Address to listen on")
+	workers := fs.Int("workers", runtime.NumCPU(), "Number of simulation workers")
+	fs.Parse(args)
+
+	if *workers < 1 {
+		log.Fatalln("workers must be at least 1")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/simulate", &workerHandler{engine: Engine{Workers: *workers}})
+
+	log.Printf("worker listening on %s with %d workers", *listen, *workers)
+	log.Fatalln(http.ListenAndServe(*listen, mux))
+}
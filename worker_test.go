@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingWriter counts the results streamed by a worker.
+type countingWriter struct {
+	http.ResponseWriter
+	lines *int64
+}
+
+func (c countingWriter) Write(b []byte) (int, error) {
+	atomic.AddInt64(c.lines, int64(bytes.Count(b, []byte("\n"))))
+	return c.ResponseWriter.Write(b)
+}
+
+func (c countingWriter) Flush() {
+	c.ResponseWriter.(http.Flusher).Flush()
+}
+
+func TestWorkerRemote(t *testing.T) {
+	var lines int64
+	var servers []*httptest.Server
+	for i := 0; i < 2; i++ {
+		wh := &workerHandler{engine: Engine{Workers: 2}}
+		servers = append(servers, httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wh.ServeHTTP(countingWriter{ResponseWriter: w, lines: &lines}, r)
+		})))
+	}
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	dropping := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"action":"turn_left"`))
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	servers = append(servers, failing, dropping)
+	defer func() {
+		for _, s := range servers {
+			s.Close()
+		}
+	}()
+
+	var addresses []string
+	for _, s := range servers {
+		addresses = append(addresses, s.URL)
+	}
+	parameters := DefaultParameters
+	parameters.EarlyStopRuns = 0
+	engine := Engine{Remote: newRemoteWorkers(addresses), Parameters: &parameters}
+
+	g := newGame(20, 20, 3)
+	data := newGameData(g, 1)
+	ctxWorker, cancelWorker := context.WithTimeout(context.Background(), 600*time.Millisecond)
+	defer cancelWorker()
+	ctxMain, cancelMain := context.WithTimeout(context.Background(), 900*time.Millisecond)
+	defer cancelMain()
+	engine.Run(ctxWorker, ctxMain, g, &data)
+
+	runs := 0
+	for a, d := range data.Collect {
+		if !IsValidAction(a) {
+			t.Errorf("unknown action %s collected", a)
+		}
+		runs += d.Run
+	}
+	if runs == 0 {
+		t.Fatal("no results collected")
+	}
+	// Results flushed by the workers at their deadline are collected as well
+	if n := atomic.LoadInt64(&lines); int64(runs) != n {
+		t.Errorf("%d results collected, %d sent by the workers", runs, n)
+	}
+
+	for i, rw := range engine.Remote {
+		rw.l.Lock()
+		failures, retry := rw.failures, rw.retry
+		rw.l.Unlock()
+		if i < 2 {
+			if failures != 0 {
+				t.Errorf("worker %d: %d failures", i, failures)
+			}
+			continue
+		}
+		if failures != 1 || !retry.After(time.Now()) {
+			t.Errorf("worker %d: %d failures, retry at %s, want backoff", i, failures, retry)
+		}
+	}
+}
+
+func TestWorkerInvalidRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(req *workerRequest)
+	}{
+		{"no game", func(req *workerRequest) { req.Game = nil }},
+		{"unknown player", func(req *workerRequest) { req.Game.You = 3 }},
+		{"wrong height", func(req *workerRequest) { req.Game.Height++ }},
+		{"wrong width", func(req *workerRequest) { req.Game.Width++ }},
+		{"invalid rules", func(req *workerRequest) { req.Game.Rules = &Rules{} }},
+		{"player outside", func(req *workerRequest) { req.Game.Players[1].X = -1 }},
+		{"player on foreign cell", func(req *workerRequest) {
+			p := req.Game.Players[1]
+			req.Game.Cells[p.Y][p.X] = 2
+		}},
+		{"invalid speed", func(req *workerRequest) { req.Game.Players[2].Speed = 0 }},
+		{"invalid direction", func(req *workerRequest) { req.Game.Players[2].Direction = "north" }},
+		{"unknown rollout", func(req *workerRequest) { req.Rollout = "UnknownAI" }},
+		{"invalid parameters", func(req *workerRequest) { req.Parameters = &Parameters{Exploration: -1} }},
+		{"profile of own player", func(req *workerRequest) {
+			req.Profiles = map[int]*OpponentProfile{1: newOpponentProfile("me")}
+		}},
+		{"negative profile count", func(req *workerRequest) {
+			p := newOpponentProfile("opponent")
+			p.Actions[1] = map[string]int{ActionNOOP: -1}
+			req.Profiles = map[int]*OpponentProfile{2: p}
+		}},
+		{"no timeout", func(req *workerRequest) { req.Timeout = 0 }},
+		{"timeout too long", func(req *workerRequest) { req.Timeout = workerMaxTimeout + time.Second }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newGame(10, 10, 2)
+			req := workerRequest{Game: g.PublicCopy(), StepCounter: map[int]int{1: 0, 2: 0}, Timeout: time.Second}
+			tt.modify(&req)
+			b, err := json.Marshal(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			wh := &workerHandler{engine: Engine{Workers: 1}}
+			wh.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/simulate", bytes.NewReader(b)))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	wh := &workerHandler{engine: Engine{Workers: 1}}
+	wh.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/simulate", bytes.NewReader([]byte("{"))))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("malformed json: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}